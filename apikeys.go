@@ -0,0 +1,250 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How stale last_used_at can get before a request updates it.
+const apiKeyTouchInterval = time.Minute
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// authenticateAPIKey checks an API key, and returns who it belongs to. The
+// key gets the scopes it was created with, less any its owner's role no
+// longer allows.
+func (cfg *apiConfig) authenticateAPIKey(r *http.Request,
+	key string) (requestAuth, error) {
+	prefix, err := auth.APIKeyPrefix(key)
+	if err != nil {
+		return requestAuth{}, err
+	}
+	stored, err := cfg.db.GetAPIKeyByPrefix(r.Context(), prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return requestAuth{}, errInvalidAPIKey
+	}
+	if err != nil {
+		return requestAuth{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(key)),
+		[]byte(stored.KeyHash)) != 1 {
+		return requestAuth{}, errInvalidAPIKey
+	}
+	if stored.ExpiresAt.Valid && time.Now().After(stored.ExpiresAt.Time) {
+		return requestAuth{}, errors.New("API key has expired")
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), stored.UserID)
+	if err != nil {
+		return requestAuth{}, err
+	}
+
+	if !stored.LastUsedAt.Valid ||
+		time.Since(stored.LastUsedAt.Time) > apiKeyTouchInterval {
+		err = cfg.db.TouchAPIKey(r.Context(), stored.ID)
+		if err != nil {
+			log.Printf("Error updating API key: %s", err.Error())
+		}
+	}
+
+	allowed := auth.ScopesForRole(user.Role)
+	var scopes []string
+	for _, scope := range strings.Fields(stored.Scope) {
+		if slices.Contains(allowed, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	claims := auth.NewClaims(user.ID, user.Role)
+	claims.Scope = strings.Join(scopes, " ")
+	return requestAuth{UserID: user.ID, APIKeyID: stored.ID, Claims: &claims},
+		nil
+}
+
+func (cfg *apiConfig) handlerAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	type AKReq struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	type Response struct {
+		ID         string     `json:"id"`
+		Key        string     `json:"key"`
+		Name       string     `json:"name"`
+		Prefix     string     `json:"prefix"`
+		Scopes     []string   `json:"scopes"`
+		Created_at time.Time  `json:"created_at"`
+		Expires_at *time.Time `json:"expires_at"`
+	}
+
+	ra := authFromContext(r.Context())
+	// A key would outlast the impersonation token it was made with.
+	if refuseImpersonation(w, r, "make API keys") {
+		return
+	}
+	// Nor can a key make another one, which could outlast it, and be used
+	// to keep a leaked or expiring key going for good.
+	if ra.APIKeyID != uuid.Nil {
+		http.Error(w, "Forbidden: API keys can't make API keys.",
+			http.StatusForbidden)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	request := AKReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if strings.TrimSpace(request.Name) == "" {
+		http.Error(w, "API keys need a name.", 400)
+		return
+	}
+	// A key can't do more than whatever's creating it.
+	if len(request.Scopes) == 0 {
+		request.Scopes = ra.Claims.Scopes()
+	}
+	for _, scope := range request.Scopes {
+		if !ra.Claims.HasScope(scope) {
+			http.Error(w, "Can't give an API key scope "+scope, 400)
+			return
+		}
+	}
+	var expiresAt sql.NullTime
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(time.Now()) {
+			http.Error(w, "Expiry time is in the past.", 400)
+			return
+		}
+		expiresAt = sql.NullTime{Time: *request.ExpiresAt, Valid: true}
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	apiKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    ra.UserID,
+		Name:      request.Name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashToken(key),
+		Scope:     strings.Join(request.Scopes, " "),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error creating API key: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("User %s created API key %s", ra.UserID, apiKey.ID)
+	cfg.audit(r, auditAPIKeyCreate, ra.UserID, map[string]any{
+		"api_key_id": apiKey.ID,
+		"scope":      apiKey.Scope,
+	})
+
+	// This is the only time the key is ever shown.
+	err = respondWithJSON(w, http.StatusCreated, Response{
+		ID:         apiKey.ID.String(),
+		Key:        key,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     strings.Fields(apiKey.Scope),
+		Created_at: apiKey.CreatedAt,
+		Expires_at: request.ExpiresAt,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	type APIKey struct {
+		ID           string     `json:"id"`
+		Name         string     `json:"name"`
+		Prefix       string     `json:"prefix"`
+		Scopes       []string   `json:"scopes"`
+		Created_at   time.Time  `json:"created_at"`
+		Expires_at   *time.Time `json:"expires_at"`
+		Last_used_at *time.Time `json:"last_used_at"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	dbKeys, err := cfg.db.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching API keys: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	keys := []APIKey{}
+	for _, dbKey := range dbKeys {
+		key := APIKey{
+			ID:         dbKey.ID.String(),
+			Name:       dbKey.Name,
+			Prefix:     dbKey.Prefix,
+			Scopes:     strings.Fields(dbKey.Scope),
+			Created_at: dbKey.CreatedAt,
+		}
+		if dbKey.ExpiresAt.Valid {
+			key.Expires_at = &dbKey.ExpiresAt.Time
+		}
+		if dbKey.LastUsedAt.Valid {
+			key.Last_used_at = &dbKey.LastUsedAt.Time
+		}
+		keys = append(keys, key)
+	}
+
+	err = respondWithJSON(w, 200, keys)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := authFromContext(r.Context()).UserID
+	reqID := r.PathValue("id")
+	keyID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid API key ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteAPIKey(r.Context(),
+		database.DeleteAPIKeyParams{ID: keyID, UserID: userID})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error deleting API key: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "No such API key.", http.StatusNotFound)
+		return
+	}
+	log.Printf("User %s deleted API key %s", userID, keyID)
+	cfg.audit(r, auditAPIKeyDelete, userID, map[string]any{
+		"api_key_id": keyID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
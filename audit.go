@@ -0,0 +1,207 @@
+package main
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/pagination"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit events. Names are "thing.what_happened", so related ones sort
+// together.
+const (
+	auditLoginSuccess        = "login.success"
+	auditLoginFailure        = "login.failure"
+	auditMagicLinkRequest    = "login.magic_link_request"
+	auditTokenRefresh        = "token.refresh"
+	auditTokenReuse          = "token.reuse"
+	auditLogout              = "session.logout"
+	auditSessionRevoke       = "session.revoke"
+	auditSessionRevokeOthers = "session.revoke_others"
+	auditUserCreate          = "user.create"
+	auditPasswordChange      = "user.password_change"
+	auditPasswordReset       = "user.password_reset"
+	auditEmailChange         = "user.email_change"
+	auditEmailVerify         = "user.email_verify"
+	auditTOTPEnable          = "totp.enable"
+	auditTOTPDisable         = "totp.disable"
+	auditAPIKeyCreate        = "api_key.create"
+	auditAPIKeyDelete        = "api_key.delete"
+	auditOAuthClientCreate   = "oauth.client_create"
+	auditOAuthAuthorize      = "oauth.authorize"
+	auditOAuthRevoke         = "oauth.revoke"
+	auditChirpDelete         = "chirp.delete"
+	auditAdminReset          = "admin.reset"
+	auditAdminSetRole        = "admin.set_role"
+	auditAdminClearLockout   = "admin.clear_lockout"
+	auditAdminImpersonate    = "admin.impersonate"
+	auditAdminImpersonateReq = "admin.impersonate_request"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// auditKey is where a page of audit events ends. Events are listed newest
+// first, and IDs only go up, so the ID's enough.
+type auditKey struct {
+	ID int64 `json:"id"`
+}
+
+// auditDetails encodes the details of an event from r, adding the admin
+// behind it if r was made with an impersonation token.
+func auditDetails(r *http.Request, details map[string]any) ([]byte, error) {
+	if details == nil {
+		details = map[string]any{}
+	}
+	if claims := authFromContext(r.Context()).Claims; claims != nil {
+		if adminID, ok := claims.Impersonator(); ok {
+			details["impersonator_id"] = adminID
+		}
+	}
+	return json.Marshal(details)
+}
+
+// audit records that actor (uuid.Nil if nobody in particular) did something,
+// from the client making r. Failing to record it is logged, but doesn't fail
+// the request; the thing has already happened. Anything done with an
+// impersonation token is put down to the user, but names the admin behind it.
+func (cfg *apiConfig) audit(r *http.Request, event string, actor uuid.UUID,
+	details map[string]any) {
+	detailsJSON, err := auditDetails(r, details)
+	if err != nil {
+		log.Printf("Error encoding audit details for %s: %s", event, err.Error())
+		detailsJSON = []byte("{}")
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	err = cfg.db.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		Event:     event,
+		ActorID:   uuid.NullUUID{UUID: actor, Valid: actor != uuid.Nil},
+		Ip:        cfg.clientIP(r),
+		UserAgent: userAgent,
+		Details:   detailsJSON,
+	})
+	if err != nil {
+		log.Printf("Error recording audit event %s: %s", event, err.Error())
+	}
+}
+
+func (cfg *apiConfig) handlerListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	type Event struct {
+		ID         int64           `json:"id"`
+		Created_at time.Time       `json:"created_at"`
+		Event      string          `json:"event"`
+		ActorID    *string         `json:"actor_id"`
+		IP         string          `json:"ip"`
+		UserAgent  string          `json:"user_agent"`
+		Details    json.RawMessage `json:"details"`
+	}
+	query := r.URL.Query()
+	params := database.ListAuditEventsParams{}
+	var err error
+	badParam := func(name string, err error) {
+		errorStr := fmt.Sprintf("Invalid %s: %s", name, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+	}
+	if event := query.Get("event"); event != "" {
+		params.Event = sql.NullString{String: event, Valid: true}
+	}
+	if ip := query.Get("ip"); ip != "" {
+		params.Ip = sql.NullString{String: ip, Valid: true}
+	}
+	if actor := query.Get("actor_id"); actor != "" {
+		params.ActorID.UUID, err = uuid.Parse(actor)
+		if err != nil {
+			badParam("actor_id", err)
+			return
+		}
+		params.ActorID.Valid = true
+	}
+	for _, timeParam := range []struct {
+		name  string
+		value *sql.NullTime
+	}{
+		{"since", &params.Since},
+		{"until", &params.Until},
+	} {
+		raw := query.Get(timeParam.name)
+		if raw == "" {
+			continue
+		}
+		timeParam.value.Time, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			badParam(timeParam.name, err)
+			return
+		}
+		timeParam.value.Valid = true
+	}
+	limit, err := pagination.ParseLimit(query.Get("limit"),
+		defaultAuditPageSize, maxAuditPageSize)
+	if err != nil {
+		badParam("limit", err)
+		return
+	}
+	// One more than asked for, to tell whether there's another page.
+	params.MaxResults = int32(limit + 1)
+	if cursor := query.Get("cursor"); cursor != "" {
+		var after auditKey
+		err = pagination.DecodeCursor(cursor, &after)
+		if err != nil {
+			badParam("cursor", err)
+			return
+		}
+		params.BeforeID = sql.NullInt64{Int64: after.ID, Valid: true}
+	}
+
+	dbEvents, err := cfg.db.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching audit events: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	dbEvents, next, err := pagination.Next(dbEvents, limit,
+		func(e database.AuditEvent) auditKey { return auditKey{ID: e.ID} })
+	if err != nil {
+		errorStr := fmt.Sprintf("Error making cursor: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	events := []Event{}
+	for _, dbEvent := range dbEvents {
+		event := Event{
+			ID:         dbEvent.ID,
+			Created_at: dbEvent.CreatedAt,
+			Event:      dbEvent.Event,
+			IP:         dbEvent.Ip,
+			UserAgent:  dbEvent.UserAgent,
+			Details:    dbEvent.Details,
+		}
+		if dbEvent.ActorID.Valid {
+			actor := dbEvent.ActorID.UUID.String()
+			event.ActorID = &actor
+		}
+		events = append(events, event)
+	}
+	pagination.SetNextPage(w.Header(), r.URL, next)
+
+	err = respondWithJSON(w, 200, events)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
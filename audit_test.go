@@ -0,0 +1,59 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAuditDetails(t *testing.T) {
+	userID, adminID := uuid.New(), uuid.New()
+	withClaims := func(claims auth.Claims) context.Context {
+		return context.WithValue(context.Background(), authContextKey,
+			requestAuth{UserID: userID, Claims: &claims})
+	}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		details map[string]any
+		want    map[string]any
+	}{
+		{"no details", context.Background(), nil, map[string]any{}},
+		{"no auth", context.Background(), map[string]any{"email": "a@b.c"},
+			map[string]any{"email": "a@b.c"}},
+		{"user's own token", withClaims(auth.NewClaims(userID, auth.RoleUser)),
+			map[string]any{"email": "a@b.c"}, map[string]any{"email": "a@b.c"}},
+		{"impersonating",
+			withClaims(auth.NewClaims(userID, auth.RoleUser,
+				auth.WithActor(adminID))),
+			nil, map[string]any{"impersonator_id": adminID.String()}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/chirps", nil).WithContext(tt.ctx)
+		data, err := auditDetails(r, tt.details)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err.Error())
+			continue
+		}
+		var got map[string]any
+		err = json.Unmarshal(data, &got)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err.Error())
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %s, want %v", tt.name, data, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: got %s, want %v", tt.name, data, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+const authContextKey contextKey = iota
+
+// requestAuth is what the auth middleware found out about who's making a
+// request.
+type requestAuth struct {
+	UserID uuid.UUID
+	// SessionID is uuid.Nil for tokens that don't belong to a login session.
+	SessionID uuid.UUID
+	// APIKeyID is set, instead, when the request used an API key.
+	APIKeyID uuid.UUID
+	// ViaCookie is set when the request used the web app's session cookie,
+	// so needs CSRF protection.
+	ViaCookie bool
+	Claims    *auth.Claims
+}
+
+// isSafeMethod reports whether method is one that shouldn't change anything.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// authFromContext returns the caller, as stashed by middlewareRequireScope.
+// It's only meaningful in handlers behind that middleware.
+func authFromContext(ctx context.Context) requestAuth {
+	ra, _ := ctx.Value(authContextKey).(requestAuth)
+	return ra
+}
+
+// authenticate checks the bearer JWT, API key or session cookie on the
+// request, and returns who it was issued to. Tokens from a revoked session or
+// app are refused.
+func (cfg *apiConfig) authenticate(r *http.Request) (requestAuth, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		key, keyErr := auth.GetAPIKey(r.Header)
+		if keyErr == nil {
+			return cfg.authenticateAPIKey(r, key)
+		}
+		ra, cookieErr := cfg.authenticateCookie(r)
+		if errors.Is(cookieErr, errNoSessionCookie) {
+			return requestAuth{}, err
+		}
+		return ra, cookieErr
+	}
+	if auth.IsAPIKey(token) {
+		return cfg.authenticateAPIKey(r, token)
+	}
+	claims, err := cfg.keyring.Parse(token)
+	if err != nil {
+		return requestAuth{}, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return requestAuth{}, err
+	}
+	if claims.ClientID != "" {
+		err = cfg.checkClientToken(r.Context(), userID, claims)
+		if err != nil {
+			return requestAuth{}, err
+		}
+	}
+	sessionID, hasSession := claims.Session()
+	if hasSession {
+		err = cfg.checkSession(r, sessionID, userID)
+		if err != nil {
+			return requestAuth{}, err
+		}
+	}
+	return requestAuth{UserID: userID, SessionID: sessionID, Claims: claims}, nil
+}
+
+// middlewareRequireScope lets a request through only if it's authenticated,
+// with a token that has scope.
+func (cfg *apiConfig) middlewareRequireScope(scope string,
+	next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ra, err := cfg.authenticate(r)
+		if err != nil {
+			log.Println("Error authenticating request: " + err.Error())
+			http.Error(w, "Authentication error: "+err.Error(),
+				http.StatusUnauthorized)
+			return
+		}
+		if ra.ViaCookie && !checkCSRF(r) {
+			log.Printf("CSRF check failed for user %s on %s %s", ra.UserID,
+				r.Method, r.URL.Path)
+			http.Error(w, "Forbidden: missing or wrong CSRF token",
+				http.StatusForbidden)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), authContextKey, ra))
+		// Everything done while impersonating is audited, including what's
+		// refused below.
+		if adminID, ok := ra.Claims.Impersonator(); ok {
+			log.Printf("Admin %s, as user %s: %s %s", adminID, ra.UserID,
+				r.Method, r.URL.Path)
+			cfg.audit(r, auditAdminImpersonateReq, adminID, map[string]any{
+				"user_id": ra.UserID,
+				"method":  r.Method,
+				"path":    r.URL.Path,
+			})
+		}
+		if ra.Claims.ReadOnly && !isSafeMethod(r.Method) {
+			http.Error(w, "Forbidden: this token is read-only",
+				http.StatusForbidden)
+			return
+		}
+		if !ra.Claims.HasScope(scope) {
+			log.Printf("User %s lacks scope %q for %s %s", ra.UserID, scope,
+				r.Method, r.URL.Path)
+			http.Error(w, "Forbidden: missing scope "+scope,
+				http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Authors can edit their chirps for a while after posting them. Every body
+// a chirp has had is kept, and anyone can see them, so an edit can't quietly
+// change what someone was replying to.
+const defaultChirpEditWindow = 15 * time.Minute
+
+var (
+	errNotYourChirp     = errors.New("not your chirp")
+	errEditWindowClosed = errors.New("chirp can no longer be edited")
+)
+
+// chirpEditWindowFromEnv reads CHIRPY_CHIRP_EDIT_WINDOW, a Go duration like
+// "15m".
+func chirpEditWindowFromEnv() (time.Duration, error) {
+	raw := os.Getenv("CHIRPY_CHIRP_EDIT_WINDOW")
+	if raw == "" {
+		return defaultChirpEditWindow, nil
+	}
+	window, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CHIRPY_CHIRP_EDIT_WINDOW: %w", err)
+	}
+	if window <= 0 {
+		return 0, errors.New("CHIRPY_CHIRP_EDIT_WINDOW must be positive")
+	}
+	return window, nil
+}
+
+// checkChirpEdit says why userID can't edit chirp at now, if they can't:
+// errNotYourChirp, or errEditWindowClosed once window has passed since it
+// was posted.
+func checkChirpEdit(chirp database.Chirp, userID uuid.UUID,
+	window time.Duration, now time.Time) error {
+	if chirp.UserID != userID {
+		return errNotYourChirp
+	}
+	if now.Sub(chirp.CreatedAt) > window {
+		return errEditWindowClosed
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerChirpEdit(w http.ResponseWriter, r *http.Request) {
+	type ECReq struct {
+		Body string `json:"body"`
+	}
+	type Chirp struct {
+		ID         string    `json:"id"`
+		Created_at time.Time `json:"created_at"`
+		Updated_at time.Time `json:"updated_at"`
+		Body       string    `json:"body"`
+		UserID     string    `json:"user_id"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	if !cfg.checkVerified(w, r, userID) {
+		return
+	}
+	reqID := r.PathValue("id")
+	chirpID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid Chirp ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	request := ECReq{}
+	err = decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if valid, err := isChirpValid(request.Body); !valid {
+		errStr := fmt.Sprintf("chirp is not valid: %s", err.Error())
+		log.Println(errStr)
+		http.Error(w, errStr, 400)
+		return
+	}
+
+	// The chirp's locked while it's edited, so two edits at once can't
+	// both think they're replacing the same body.
+	var edited database.Chirp
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		chirp, err := q.GetChirpByIDForUpdate(r.Context(), chirpID)
+		if err != nil {
+			return err
+		}
+		err = checkChirpEdit(chirp, userID, cfg.chirpEditWindow, time.Now())
+		if err != nil {
+			return err
+		}
+		if chirp.Body == request.Body {
+			edited = chirp
+			return nil
+		}
+		err = q.CreateChirpRevision(r.Context(),
+			database.CreateChirpRevisionParams{
+				ChirpID:   chirp.ID,
+				CreatedAt: chirp.UpdatedAt,
+				Body:      chirp.Body,
+			})
+		if err != nil {
+			return err
+		}
+		edited, err = q.UpdateChirpBody(r.Context(),
+			database.UpdateChirpBodyParams{ID: chirp.ID, Body: request.Body})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such chirp.", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errNotYourChirp) || errors.Is(err, errEditWindowClosed) {
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error editing chirp: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, Chirp{
+		ID:         edited.ID.String(),
+		Created_at: edited.CreatedAt,
+		Updated_at: edited.UpdatedAt,
+		Body:       edited.Body,
+		UserID:     edited.UserID.String(),
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+// handlerChirpRevisions lists a chirp's earlier bodies, oldest first.
+func (cfg *apiConfig) handlerChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	type Revision struct {
+		ID          int64     `json:"id"`
+		Created_at  time.Time `json:"created_at"`
+		Replaced_at time.Time `json:"replaced_at"`
+		Body        string    `json:"body"`
+	}
+
+	reqID := r.PathValue("id")
+	chirpID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid Chirp ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	_, err = cfg.db.GetChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such chirp.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching Chirp: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	dbRevisions, err := cfg.db.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching revisions: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	revisions := []Revision{}
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, Revision{
+			ID:          dbRevision.ID,
+			Created_at:  dbRevision.CreatedAt,
+			Replaced_at: dbRevision.ReplacedAt,
+			Body:        dbRevision.Body,
+		})
+	}
+
+	err = respondWithJSON(w, http.StatusOK, revisions)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"chirpy/internal/database"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestChirpEditWindowFromEnv(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", defaultChirpEditWindow, false},
+		{"1h", time.Hour, false},
+		{"90s", 90 * time.Second, false},
+		{"0s", 0, true},
+		{"-5m", 0, true},
+		{"15", 0, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("CHIRPY_CHIRP_EDIT_WINDOW", tt.raw)
+		got, err := chirpEditWindowFromEnv()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCheckChirpEdit(t *testing.T) {
+	authorID := uuid.New()
+	posted := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	chirp := database.Chirp{ID: uuid.New(), UserID: authorID,
+		CreatedAt: posted}
+	window := 15 * time.Minute
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		now    time.Time
+		want   error
+	}{
+		{"just posted", authorID, posted, nil},
+		{"last moment", authorID, posted.Add(window), nil},
+		{"too late", authorID, posted.Add(window + time.Second),
+			errEditWindowClosed},
+		{"someone else", uuid.New(), posted, errNotYourChirp},
+		{"someone else, too late", uuid.New(), posted.Add(time.Hour),
+			errNotYourChirp},
+	}
+	for _, tt := range tests {
+		err := checkChirpEdit(chirp, tt.userID, window, tt.now)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
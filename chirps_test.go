@@ -0,0 +1,175 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/pagination"
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCanDeleteChirp(t *testing.T) {
+	authorID, otherID, adminID := uuid.New(), uuid.New(), uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), UserID: authorID}
+	requester := func(userID uuid.UUID, role string,
+		opts ...auth.TokenOption) requestAuth {
+		claims := auth.NewClaims(userID, role, opts...)
+		return requestAuth{UserID: userID, Claims: &claims}
+	}
+
+	tests := []struct {
+		name string
+		ra   requestAuth
+		want bool
+	}{
+		{"author", requester(authorID, auth.RoleUser), true},
+		{"someone else", requester(otherID, auth.RoleUser), false},
+		{"admin", requester(adminID, auth.RoleAdmin), true},
+		// Impersonation tokens never carry the admin scope, even when it's
+		// an admin being impersonated.
+		{"impersonated admin", requester(adminID, auth.RoleAdmin,
+			auth.WithActor(otherID)), false},
+		{"no claims", requestAuth{UserID: otherID}, false},
+	}
+	for _, tt := range tests {
+		if got := canDeleteChirp(tt.ra, chirp); got != tt.want {
+			t.Errorf("%s: canDeleteChirp = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseChirpFilter(t *testing.T) {
+	authorID := uuid.New()
+	cursor, err := pagination.EncodeCursor(pagination.TimeKey{
+		CreatedAt: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		ID:        uuid.New(),
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	filter, err := parseChirpFilter(url.Values{
+		"author_id": {authorID.String()},
+		"since":     {"2030-01-01T00:00:00Z"},
+		"sort":      {"desc"},
+		"limit":     {"10"},
+		"cursor":    {cursor},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !filter.author.Valid || filter.author.UUID != authorID ||
+		!filter.desc || filter.limit != 10 {
+		t.Errorf("Got %+v", filter)
+	}
+	if filter.params.MaxResults != 11 {
+		t.Errorf("Should fetch one more than the limit, not %d",
+			filter.params.MaxResults)
+	}
+	if !filter.params.Since.Valid || filter.params.Until.Valid ||
+		!filter.params.AfterCreatedAt.Valid || !filter.params.AfterID.Valid {
+		t.Errorf("Wrong filters: %+v", filter.params)
+	}
+
+	filter, err = parseChirpFilter(url.Values{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if filter.author.Valid || filter.desc ||
+		filter.limit != defaultChirpPageSize {
+		t.Errorf("Defaults: got %+v", filter)
+	}
+
+	for _, bad := range []struct {
+		name  string
+		value string
+	}{
+		{"author_id", "nobody"},
+		{"since", "yesterday"},
+		{"until", "2030-01-01"},
+		{"sort", "random"},
+		{"limit", "0"},
+		{"cursor", "not a cursor"},
+	} {
+		_, err := parseChirpFilter(url.Values{bad.name: {bad.value}})
+		var perr *paramError
+		if !errors.As(err, &perr) || perr.name != bad.name {
+			t.Errorf("%s=%s: got %v, want a paramError", bad.name, bad.value,
+				err)
+		}
+	}
+}
+
+// queryRecorder is a database connection that remembers the last query it
+// was asked to run, and fails it.
+type queryRecorder struct {
+	query string
+	args  []interface{}
+}
+
+var errRecorded = errors.New("query recorded")
+
+func (q *queryRecorder) ExecContext(_ context.Context, query string,
+	args ...interface{}) (sql.Result, error) {
+	q.query, q.args = query, args
+	return nil, errRecorded
+}
+
+func (q *queryRecorder) PrepareContext(_ context.Context,
+	query string) (*sql.Stmt, error) {
+	q.query = query
+	return nil, errRecorded
+}
+
+func (q *queryRecorder) QueryContext(_ context.Context, query string,
+	args ...interface{}) (*sql.Rows, error) {
+	q.query, q.args = query, args
+	return nil, errRecorded
+}
+
+func (q *queryRecorder) QueryRowContext(_ context.Context, query string,
+	args ...interface{}) *sql.Row {
+	panic("unexpected QueryRowContext: " + query)
+}
+
+func TestChirpFilterList(t *testing.T) {
+	authorID := uuid.New()
+	tests := []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{}, "ListChirps"},
+		{url.Values{"sort": {"desc"}}, "ListChirpsDesc"},
+		{url.Values{"author_id": {authorID.String()}}, "ListChirpsByAuthor"},
+		{url.Values{"author_id": {authorID.String()}, "sort": {"desc"}},
+			"ListChirpsByAuthorDesc"},
+	}
+	for _, tt := range tests {
+		filter, err := parseChirpFilter(tt.query)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		db := &queryRecorder{}
+		_, err = filter.list(context.Background(), database.New(db))
+		if !errors.Is(err, errRecorded) {
+			t.Fatalf("%v: got %v", tt.query, err)
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(db.query, "-- name: "),
+			" ")
+		if name != tt.want {
+			t.Errorf("%v: ran %s, want %s", tt.query, name, tt.want)
+		}
+		if filter.author.Valid &&
+			(len(db.args) == 0 || db.args[0] != authorID) {
+			t.Errorf("%v: author should be the first argument: %v",
+				tt.query, db.args)
+		}
+	}
+}
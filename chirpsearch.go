@@ -0,0 +1,127 @@
+package main
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/pagination"
+	"chirpy/internal/search"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chirps are searched with Postgres's full-text search, over a tsvector
+// column it keeps up to date itself. See search.ParseQuery for what a query
+// can have in it.
+const maxSearchQueryLength = 256
+
+// searchKey is the sort key of search results: best match first, then
+// newest.
+type searchKey struct {
+	Rank      float32   `json:"r"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+var snippetMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// snippetHTML makes a snippet from SearchChirps safe to show as HTML, with
+// its matches in <mark>s.
+func snippetHTML(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
+
+func (cfg *apiConfig) handlerChirpSearch(w http.ResponseWriter, r *http.Request) {
+	type Chirp struct {
+		ID         string    `json:"id"`
+		Created_at time.Time `json:"created_at"`
+		Updated_at time.Time `json:"updated_at"`
+		Body       string    `json:"body"`
+		UserID     string    `json:"user_id"`
+		Rank       float32   `json:"rank"`
+		Snippet    string    `json:"snippet"`
+	}
+
+	query := r.URL.Query()
+	params := database.SearchChirpsParams{}
+	var err error
+	badParam := func(name string, err error) {
+		errorStr := fmt.Sprintf("Invalid %s: %s", name, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+	}
+	q := query.Get("q")
+	if len(q) > maxSearchQueryLength {
+		http.Error(w, fmt.Sprintf("q can be at most %d bytes.",
+			maxSearchQueryLength), 400)
+		return
+	}
+	params.Query, err = search.ParseQuery(q)
+	if err != nil {
+		badParam("q", err)
+		return
+	}
+	limit, err := pagination.ParseLimit(query.Get("limit"),
+		defaultChirpPageSize, maxChirpPageSize)
+	if err != nil {
+		badParam("limit", err)
+		return
+	}
+	// One more than asked for, to tell whether there's another page.
+	params.MaxResults = int32(limit + 1)
+	if cursor := query.Get("cursor"); cursor != "" {
+		var after searchKey
+		err = pagination.DecodeCursor(cursor, &after)
+		if err != nil {
+			badParam("cursor", err)
+			return
+		}
+		params.AfterRank = sql.NullFloat64{Float64: float64(after.Rank),
+			Valid: true}
+		params.AfterCreatedAt = sql.NullTime{Time: after.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: after.ID, Valid: true}
+	}
+
+	results, err := cfg.db.SearchChirps(r.Context(), params)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error searching chirps: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	results, next, err := pagination.Next(results, limit,
+		func(c database.SearchChirpsRow) searchKey {
+			return searchKey{Rank: c.Rank, CreatedAt: c.CreatedAt, ID: c.ID}
+		})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error making cursor: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	chirps := []Chirp{}
+	for _, result := range results {
+		chirps = append(chirps, Chirp{
+			ID:         result.ID.String(),
+			Created_at: result.CreatedAt,
+			Updated_at: result.UpdatedAt,
+			Body:       result.Body,
+			UserID:     result.UserID.String(),
+			Rank:       result.Rank,
+			Snippet:    snippetHTML(result.Snippet),
+		})
+	}
+	pagination.SetNextPage(w.Header(), r.URL, next)
+
+	err = respondWithJSON(w, 200, chirps)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
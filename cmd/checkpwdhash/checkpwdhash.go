@@ -8,7 +8,8 @@ import (
 
 func main() {
 	if len(os.Args[1:]) != 2 {
-		fmt.Fprintln(os.Stderr, "usage: checkpwdhash hash password")
+		fmt.Fprintln(os.Stderr, "usage: checkpwdhash hash password\n"+
+			"  hash can be argon2id or bcrypt")
 		os.Exit(-1)
 	}
 	hashstring := os.Args[1]
@@ -18,5 +19,9 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(-1)
 	}
+	if auth.NeedsRehash(hashstring) {
+		fmt.Println("match (would be rehashed with the default hasher on login)")
+		return
+	}
 	fmt.Println("match")
 }
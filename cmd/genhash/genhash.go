@@ -5,11 +5,21 @@ import "fmt"
 import "os"
 
 func main() {
-	if len(os.Args[1:]) != 1 {
-		fmt.Fprintln(os.Stderr, "usage: genhash password")
+	if len(os.Args[1:]) < 1 || len(os.Args[1:]) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: genhash [algorithm[:params]] password")
+		fmt.Fprintln(os.Stderr, "  e.g. genhash bcrypt:cost=12 hunter2")
+		fmt.Fprintln(os.Stderr, "       genhash argon2id:m=65536,t=3,p=2 hunter2")
 		os.Exit(-1)
 	}
-	pwd := os.Args[1]
+	pwd := os.Args[len(os.Args)-1]
+	if len(os.Args[1:]) == 2 {
+		hasher, err := auth.ParseHasher(os.Args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(-1)
+		}
+		auth.SetPasswordHasher(hasher)
+	}
 	hashedpw, err := auth.HashPassword(pwd)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Prints a new PKCS#8 PEM private key, for use in a keyring file.
+func main() {
+	if len(os.Args[1:]) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: genkey ed25519|rsa")
+		os.Exit(-1)
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	switch os.Args[1] {
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		fmt.Fprintln(os.Stderr, "unknown key type: "+os.Args[1])
+		os.Exit(-1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(-1)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(-1)
+	}
+	err = pem.Encode(os.Stdout, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(-1)
+	}
+}
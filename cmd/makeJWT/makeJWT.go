@@ -50,7 +50,7 @@ func main() {
 	// Parse arguments
 	if len(os.Args) < 3 || len(os.Args) > 4 {
 		fmt.Fprintln(os.Stderr,
-			"wrong argument arity;\nusage: <makeJWT> UUID secret [expiresIn]")
+			"wrong argument arity;\nusage: <makeJWT> UUID secret|@keyring.json [expiresIn]")
 		os.Exit(-1)
 	}
 	var jwtUUID uuid.UUID
@@ -65,10 +65,14 @@ func main() {
 	}
 
 	secret := os.Args[2]
+	keyring, err := auth.KeyringFromArg(secret)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(-1)
+	}
 
 	expiresInMinutes := 5
 	if len(os.Args) == 4 {
-		var err error
 		expiresInMinutes, err = strconv.Atoi(os.Args[3])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "invalid expiry time: "+err.Error())
@@ -76,7 +80,7 @@ func main() {
 	}
 	expiresIn := time.Minute * time.Duration(expiresInMinutes)
 
-	jwt, err := auth.MakeJWT(jwtUUID, secret, expiresIn)
+	jwt, err := keyring.MakeJWT(jwtUUID, expiresIn)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(-1)
@@ -10,14 +10,20 @@ import (
 func main() {
 	if len(os.Args) != 3 {
 		fmt.Fprintln(os.Stderr, "invalid number of arguments"+"\n"+
-			"usage: <validateJTW> jwt secret")
+			"usage: <validateJTW> jwt secret|@keyring.json")
 		os.Exit(-1)
 	}
 
 	jwt := os.Args[1]
 	secret := os.Args[2]
 
-	uuid, err := auth.ValidateJWT(jwt, secret)
+	keyring, err := auth.KeyringFromArg(secret)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(-1)
+	}
+
+	uuid, err := keyring.ValidateJWT(jwt)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error decoding token: "+err.Error())
 		os.Exit(-1)
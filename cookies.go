@@ -0,0 +1,174 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The web app can log in with a session cookie, so that it never has to
+// keep a token where scripts can read it. Requests authenticated by cookie
+// that change anything also need the double-submit CSRF token: the value of
+// the (script-readable) CSRF cookie, sent back in a header. Another site can
+// make the browser send the cookies, but can't read them to fill in the
+// header. The __Host- prefix stops a sibling subdomain planting either one.
+const (
+	sessionCookieName   = "__Host-chirpy_session"
+	csrfCookieName      = "__Host-chirpy_csrf"
+	csrfHeaderName      = "X-CSRF-Token"
+	cookieSessionExpiry = 14 * 24 * time.Hour
+)
+
+var errNoSessionCookie = errors.New("no session cookie found")
+
+// startCookieSession starts a session for user held in a cookie, and returns
+// the CSRF token to go with it.
+func (cfg *apiConfig) startCookieSession(w http.ResponseWriter, r *http.Request,
+	user database.User) (string, error) {
+	session, err := cfg.startSession(r, user.ID)
+	if err != nil {
+		return "", err
+	}
+	cookieToken, err := auth.MakeToken()
+	if err != nil {
+		return "", err
+	}
+	csrfToken, err := auth.MakeToken()
+	if err != nil {
+		return "", err
+	}
+	err = cfg.db.SetSessionCookie(r.Context(), database.SetSessionCookieParams{
+		ID: session.ID,
+		CookieHash: sql.NullString{
+			String: auth.HashToken(cookieToken),
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing session cookie: %w", err)
+	}
+
+	maxAge := int(cookieSessionExpiry.Seconds())
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    cookieToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return csrfToken, nil
+}
+
+// clearSessionCookies tells the browser to forget its session.
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{sessionCookieName, csrfCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Path:   "/",
+			MaxAge: -1,
+			Secure: true,
+		})
+	}
+}
+
+// authenticateCookie checks the session cookie on the request, if any, and
+// returns who it belongs to. CSRF is checked separately; see checkCSRF.
+func (cfg *apiConfig) authenticateCookie(r *http.Request) (requestAuth, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return requestAuth{}, errNoSessionCookie
+	}
+	session, err := cfg.db.GetSessionByCookie(r.Context(), sql.NullString{
+		String: auth.HashToken(cookie.Value),
+		Valid:  true,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return requestAuth{}, errors.New("no such session")
+	}
+	if err != nil {
+		return requestAuth{}, err
+	}
+	if time.Since(session.CreatedAt) > cookieSessionExpiry {
+		return requestAuth{}, errors.New("session has expired")
+	}
+	err = cfg.checkSession(r, session.ID, session.UserID)
+	if err != nil {
+		return requestAuth{}, err
+	}
+	// Unlike a token, the cookie doesn't carry the user's role, so it's
+	// looked up every time.
+	user, err := cfg.db.GetUserByID(r.Context(), session.UserID)
+	if err != nil {
+		return requestAuth{}, err
+	}
+	claims := auth.NewClaims(user.ID, user.Role, auth.WithSession(session.ID))
+	return requestAuth{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		ViaCookie: true,
+		Claims:    &claims,
+	}, nil
+}
+
+// checkCSRF reports whether a cookie-authenticated request may go ahead:
+// either it can't change anything, or it has the right CSRF token.
+func checkCSRF(r *http.Request) bool {
+	if isSafeMethod(r.Method) {
+		return true
+	}
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(csrfHeaderName)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+// handlerLogout ends the session the request belongs to, however it's
+// authenticated, and clears any session cookies.
+func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request) {
+	ra, err := cfg.authenticate(r)
+	if err != nil {
+		log.Println("Error authenticating request: " + err.Error())
+		http.Error(w, "Authentication error: "+err.Error(),
+			http.StatusUnauthorized)
+		return
+	}
+	if ra.ViaCookie && !checkCSRF(r) {
+		http.Error(w, "Forbidden: missing or wrong CSRF token",
+			http.StatusForbidden)
+		return
+	}
+	if ra.SessionID != uuid.Nil {
+		_, err = cfg.revokeSession(r.Context(), ra.SessionID, ra.UserID)
+		if err != nil {
+			errorStr := fmt.Sprintf("Error revoking session: %s", err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 500)
+			return
+		}
+	}
+	cfg.audit(r, auditLogout, ra.UserID, map[string]any{
+		"session_id": ra.SessionID,
+	})
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		want   bool
+	}{
+		{"safe method, no token", http.MethodGet, "", "", true},
+		{"matching token", http.MethodPost, "abc", "abc", true},
+		{"no header", http.MethodPost, "abc", "", false},
+		{"wrong header", http.MethodDelete, "abc", "abd", false},
+		{"prefix of token", http.MethodPut, "abc", "ab", false},
+		{"no cookie", http.MethodPost, "", "abc", false},
+		{"both empty", http.MethodPost, "", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/chirps", nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tt.cookie})
+		}
+		if tt.header != "" {
+			r.Header.Set(csrfHeaderName, tt.header)
+		}
+		if got := checkCSRF(r); got != tt.want {
+			t.Errorf("%s: checkCSRF = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,10 +3,11 @@ module chirpy
 go 1.24.1
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.39.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+require golang.org/x/sys v0.33.0 // indirect
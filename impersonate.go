@@ -0,0 +1,128 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Admins can get a short-lived token to see Chirpy as a user does. It names
+// the admin in its act claim, never has the admin scope, and unless asked
+// for otherwise, is read-only. Everything done with it is logged, and the
+// audit log puts it down to the admin as well as the user.
+const (
+	defaultImpersonationExpiry = 15 * time.Minute
+	maxImpersonationExpiry     = time.Hour
+)
+
+func (cfg *apiConfig) handlerImpersonate(w http.ResponseWriter, r *http.Request) {
+	type IReq struct {
+		Reason           string `json:"reason"`
+		AllowWrites      bool   `json:"allow_writes"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+	type Response struct {
+		Token      string    `json:"token"`
+		UserID     string    `json:"user_id"`
+		ReadOnly   bool      `json:"read_only"`
+		Expires_at time.Time `json:"expires_at"`
+	}
+
+	adminID := authFromContext(r.Context()).UserID
+	reqID := r.PathValue("id")
+	userID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid user ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if userID == adminID {
+		http.Error(w, "You can't impersonate yourself.", 400)
+		return
+	}
+	// The body is optional; with none, the defaults do.
+	decoder := json.NewDecoder(r.Body)
+	request := IReq{}
+	err = decoder.Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	expiresIn := defaultImpersonationExpiry
+	if request.ExpiresInSeconds > 0 {
+		expiresIn = min(time.Second*time.Duration(request.ExpiresInSeconds),
+			maxImpersonationExpiry)
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such user.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	opts := []auth.TokenOption{auth.WithActor(adminID)}
+	if !request.AllowWrites {
+		opts = append(opts, auth.ReadOnly())
+	}
+	token, err := cfg.keyring.Sign(auth.NewClaims(user.ID, user.Role, opts...),
+		expiresIn)
+	if err != nil {
+		log.Println("Couldn't generate JWT: " + err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(expiresIn)
+	log.Printf("Admin %s is impersonating user %s until %s", adminID, user.ID,
+		expiresAt.Format(time.RFC3339))
+	cfg.audit(r, auditAdminImpersonate, adminID, map[string]any{
+		"user_id":      user.ID,
+		"reason":       request.Reason,
+		"allow_writes": request.AllowWrites,
+		"expires_at":   expiresAt,
+	})
+
+	err = respondWithJSON(w, http.StatusOK, Response{
+		Token:      token,
+		UserID:     user.ID.String(),
+		ReadOnly:   !request.AllowWrites,
+		Expires_at: expiresAt,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+// refuseImpersonation answers 403, and returns true, if r was made with an
+// impersonation token. Changes to how an account is logged into, or who can
+// act for it (its email, password, 2FA, sessions, API keys and OAuth apps),
+// are left to the user, so that an admin can't use them to keep access, or
+// take the account over.
+func refuseImpersonation(w http.ResponseWriter, r *http.Request,
+	what string) bool {
+	if _, ok := authFromContext(r.Context()).Claims.Impersonator(); !ok {
+		return false
+	}
+	http.Error(w, "Forbidden: can't "+what+" while impersonating.",
+		http.StatusForbidden)
+	return true
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API keys look like chirpy_<prefix>_<secret>. The prefix isn't secret; it's
+// stored as is so a key can be found, and recognized by its owner, without
+// the rest of it, which is only stored hashed (see HashToken).
+const (
+	apiKeyTag         = "chirpy_"
+	apiKeyPrefixBytes = 6
+)
+
+var ErrNoAPIKey = errors.New("no API key found")
+
+// MakeAPIKey returns a new API key, and its prefix.
+func MakeAPIKey() (string, string, error) {
+	buf := make([]byte, apiKeyPrefixBytes)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating API key: %w", err)
+	}
+	prefix := hex.EncodeToString(buf)
+	secret, err := MakeToken()
+	if err != nil {
+		return "", "", err
+	}
+	return apiKeyTag + prefix + "_" + secret, prefix, nil
+}
+
+// IsAPIKey reports whether token looks like an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyTag)
+}
+
+// APIKeyPrefix returns the prefix of an API key.
+func APIKeyPrefix(key string) (string, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyTag)
+	if !ok {
+		return "", errors.New("not an API key")
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 2*apiKeyPrefixBytes || secret == "" {
+		return "", errors.New("malformed API key")
+	}
+	return prefix, nil
+}
+
+// GetAPIKey returns the key from an "Authorization: ApiKey <key>" header.
+// Keys can also be sent as bearer tokens; see IsAPIKey.
+func GetAPIKey(headers http.Header) (string, error) {
+	for _, authForm := range headers.Values("Authorization") {
+		if key, ok := strings.CutPrefix(authForm, "ApiKey "); ok {
+			return strings.TrimSpace(key), nil
+		}
+	}
+	return "", ErrNoAPIKey
+}
@@ -1,80 +1,29 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-const cost = 10
 const issuer = "chirpy"
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
-	if err != nil {
-		return "", fmt.Errorf("error hashing password: %w", err)
-	}
-	return string(hash), nil
-}
-
-func CheckPasswordHash(hash, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	switch {
-	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-		return fmt.Errorf("password does not match")
-	case err != nil:
-		return fmt.Errorf("invalid hash or comparison failed: %w", err)
-	}
-	return nil
-}
-
-func MakeJWT(userID uuid.UUID, tokenSecret string,
-	expiresIn time.Duration) (string, error) {
-
-	timeNow := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    issuer,
-		IssuedAt:  jwt.NewNumericDate(timeNow),
-		ExpiresAt: jwt.NewNumericDate(timeNow.Add(expiresIn)),
-		Subject:   userID.String(),
-	})
-	ss, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", fmt.Errorf("error creating JWT token: %w", err)
-	}
-	return ss, nil
+// MakeJWT signs an HS256 token for userID with tokenSecret.
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration,
+	opts ...TokenOption) (string, error) {
+	return NewHMACKeyring(tokenSecret).MakeJWT(userID, expiresIn, opts...)
 }
 
+// ValidateJWT checks an HS256 token against tokenSecret.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{},
-		func(token *jwt.Token) (any, error) {
-			return []byte(tokenSecret), nil
-		})
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("invalid JWT: %w", err)
-	}
-	if token.Method != jwt.SigningMethodHS256 {
-		return uuid.UUID{}, fmt.Errorf("unexpected signing method: %v",
-			token.Header["alg"])
-	}
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return uuid.UUID{}, errors.New("invalid 'claims' in JWT")
-	}
-	if claims.Issuer != issuer {
-		return uuid.UUID{}, fmt.Errorf("invalid issuer: %v", claims.Issuer)
-	}
-	subjectUUID, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("cannot parse UUID: %w", err)
-	}
-	return subjectUUID, nil
+	return NewHMACKeyring(tokenSecret).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -89,3 +38,26 @@ func GetBearerToken(headers http.Header) (string, error) {
 	}
 	return "", errors.New("no bearer token found")
 }
+
+// MakeToken returns a random, hex-encoded 256-bit token. It's opaque; only
+// its hash (see HashToken) should ever be stored.
+func MakeToken() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// MakeRefreshToken returns a new refresh token; see MakeToken.
+func MakeRefreshToken() (string, error) {
+	return MakeToken()
+}
+
+// HashToken hashes an opaque, high-entropy token for storage. These tokens are
+// random already, so a fast hash is fine here; passwords need HashPassword.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
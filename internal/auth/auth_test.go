@@ -2,11 +2,13 @@ package auth_test
 
 import (
 	"chirpy/internal/auth"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCheckPasswordHash(t *testing.T) {
@@ -56,6 +58,31 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func TestCheckLoginPassword(t *testing.T) {
+	hash, err := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("abc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := auth.CheckLoginPassword(hash, "abc"); err != nil {
+		t.Errorf("bcrypt hash should match: %s", err.Error())
+	}
+
+	// The default hasher is far slower than bcrypt at its lowest cost, so
+	// the wrong password should be held up to about its speed.
+	start := time.Now()
+	auth.FakePasswordCheck("abd")
+	fake := time.Since(start)
+	start = time.Now()
+	err = auth.CheckLoginPassword(hash, "abd")
+	if err != auth.ErrPasswordMismatch {
+		t.Errorf("bcrypt hash should mismatch, but got: %v", err)
+	}
+	if took := time.Since(start); took < fake/2 {
+		t.Errorf("Old hash checked in %s, but a fake check takes %s", took,
+			fake)
+	}
+}
+
 func TestValidateJWT(t *testing.T) {
 	// Make a simple JWT, and make sure it decodes
 	jwtuuid := uuid.New()
@@ -78,3 +105,375 @@ func TestValidateJWT(t *testing.T) {
 		t.Errorf("generated and decoded UUIDs not equal")
 	}
 }
+
+func TestMakeRefreshToken(t *testing.T) {
+	first, err := auth.MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	second, err := auth.MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(first) != 64 {
+		t.Errorf("refresh token should be 64 hex chars, is %d", len(first))
+	}
+	if first == second {
+		t.Errorf("two refresh tokens should not be equal: %s", first)
+	}
+	if auth.HashToken(first) == first {
+		t.Errorf("hashed token should differ from the token")
+	}
+	if auth.HashToken(first) != auth.HashToken(first) {
+		t.Errorf("hashing the same token should be deterministic")
+	}
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	// Small parameters, to keep the test fast.
+	hasher, err := auth.ParseHasher("argon2id:m=1024,t=1,p=1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	hash, err := hasher.Hash("⚰ 🌻 ♚")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("unexpected argon2id hash format: %s", hash)
+	}
+	if err := auth.CheckPasswordHash(hash, "⚰ 🌻 ♚"); err != nil {
+		t.Errorf("argon2id hash should match: %s", err.Error())
+	}
+	err = auth.CheckPasswordHash(hash, "⚰ 🌻")
+	if err != auth.ErrPasswordMismatch {
+		t.Errorf("argon2id hash should mismatch, but got: %v", err)
+	}
+	if !hasher.IsCurrent(hash) {
+		t.Errorf("hash should be current for the hasher that made it")
+	}
+
+	stronger, err := auth.ParseHasher("argon2id:m=2048,t=1,p=1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if stronger.IsCurrent(hash) {
+		t.Errorf("hash with different parameters should not be current")
+	}
+	bcryptHash := "$2a$10$IFDDc.mCoiADcZGvbozkp.xGAJteuGAEtqM.r8tmO1x/MMEScC7ru"
+	if hasher.IsCurrent(bcryptHash) {
+		t.Errorf("bcrypt hash should not be current for argon2id")
+	}
+}
+
+func TestParseHasher(t *testing.T) {
+	valid := []string{"argon2id", "argon2id:t=4", "bcrypt", "bcrypt:cost=12"}
+	invalid := []string{"", "md5", "bcrypt:cost=99", "bcrypt:t=3",
+		"argon2id:m", "argon2id:p=0", "argon2id:x=1"}
+	for _, spec := range valid {
+		if _, err := auth.ParseHasher(spec); err != nil {
+			t.Errorf("'%s' should parse, but doesn't: %s", spec, err.Error())
+		}
+	}
+	for _, spec := range invalid {
+		if _, err := auth.ParseHasher(spec); err == nil {
+			t.Errorf("'%s' should not parse, but does", spec)
+		}
+	}
+}
+
+func TestClaimsScopes(t *testing.T) {
+	kr := auth.NewHMACKeyring("secret")
+	userID := uuid.New()
+	for _, testcase := range []struct {
+		role    string
+		isAdmin bool
+	}{
+		{auth.RoleUser, false},
+		{auth.RoleAdmin, true},
+	} {
+		jwt, err := kr.Sign(auth.NewClaims(userID, testcase.role), time.Minute)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		claims, err := kr.Parse(jwt)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if claims.Role != testcase.role {
+			t.Errorf("role should be '%s', is '%s'", testcase.role, claims.Role)
+		}
+		if !claims.HasScope(auth.ScopeChirpsWrite) {
+			t.Errorf("'%s' should be able to write chirps", testcase.role)
+		}
+		if claims.HasScope(auth.ScopeAdmin) != testcase.isAdmin {
+			t.Errorf("'%s' admin scope should be %v", testcase.role,
+				testcase.isAdmin)
+		}
+	}
+
+	if len(auth.ScopesForRole("superuser")) != 0 {
+		t.Errorf("unknown roles should have no scopes")
+	}
+}
+
+func TestChallengeTokens(t *testing.T) {
+	kr := auth.NewHMACKeyring("secret")
+	userID := uuid.New()
+	challenge, err := kr.Sign(
+		auth.NewChallengeClaims(userID, auth.AudienceLoginChallenge),
+		time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := kr.Parse(challenge); err == nil {
+		t.Errorf("challenge token should not pass as an access token")
+	}
+	claims, err := kr.ParseFor(challenge, auth.AudienceLoginChallenge)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if claims.Subject != userID.String() || claims.Scope != "" {
+		t.Errorf("unexpected challenge claims: %+v", claims)
+	}
+
+	access, err := kr.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := kr.ParseFor(access, auth.AudienceLoginChallenge); err == nil {
+		t.Errorf("access token should not pass as a challenge token")
+	}
+}
+
+func TestClientTokens(t *testing.T) {
+	userID := uuid.New()
+	jwt, err := auth.MakeJWT(userID, "secret", time.Minute,
+		auth.WithClient("some-client", auth.ClientScopes))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	claims, err := auth.NewHMACKeyring("secret").Parse(jwt)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if claims.ClientID != "some-client" {
+		t.Errorf("client ID should be 'some-client', is '%s'", claims.ClientID)
+	}
+	if !claims.HasScope(auth.ScopeChirpsWrite) ||
+		claims.HasScope(auth.ScopeUsersWrite) {
+		t.Errorf("client token has the wrong scopes: '%s'", claims.Scope)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636, appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if auth.PKCEChallenge(verifier) != challenge {
+		t.Errorf("challenge for '%s' should be '%s', is '%s'", verifier,
+			challenge, auth.PKCEChallenge(verifier))
+	}
+	if !auth.VerifyPKCE(verifier, challenge) {
+		t.Errorf("'%s' should match '%s'", verifier, challenge)
+	}
+	for _, bad := range []string{
+		verifier[:42],
+		verifier + "x",
+		"dBjftJeZ4CVP+mB92K27uhbUJU1p1r/wW1gFWFOEjXk",
+	} {
+		if auth.VerifyPKCE(bad, challenge) {
+			t.Errorf("'%s' should not match '%s'", bad, challenge)
+		}
+	}
+}
+
+func TestPoW(t *testing.T) {
+	kr := auth.NewHMACKeyring("secret")
+	challenge, err := kr.Sign(auth.NewPoWClaims(12), time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := kr.Parse(challenge); err == nil {
+		t.Errorf("proof-of-work challenge should not pass as an access token")
+	}
+	claims, err := kr.ParseFor(challenge, auth.AudienceSignupChallenge)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if claims.Difficulty != 12 {
+		t.Errorf("difficulty should be 12, is %d", claims.Difficulty)
+	}
+
+	solution := auth.SolvePoW(challenge, claims.Difficulty)
+	if !auth.VerifyPoW(challenge, solution, claims.Difficulty) {
+		t.Errorf("'%s' should solve the challenge", solution)
+	}
+	// Unless the solver got very lucky, the same solution won't do for a
+	// much harder challenge, or for another challenge.
+	if auth.VerifyPoW(challenge, solution, 40) {
+		t.Errorf("'%s' shouldn't solve the challenge at difficulty 40",
+			solution)
+	}
+	if auth.VerifyPoW(challenge+"x", solution, 24) {
+		t.Errorf("'%s' shouldn't solve another challenge", solution)
+	}
+
+	tests := []struct {
+		base, recent, target, want int
+	}{
+		{16, 0, 10, 16},
+		{16, 10, 10, 16},
+		{16, 11, 10, 17},
+		{16, 20, 10, 17},
+		{16, 21, 10, 18},
+		{16, 40, 10, 18},
+		{16, 41, 10, 19},
+		{16, 100000, 10, auth.MaxPoWDifficulty},
+		{16, 100, 0, 16},
+	}
+	for _, tc := range tests {
+		got := auth.PoWDifficulty(tc.base, tc.recent, tc.target)
+		if got != tc.want {
+			t.Errorf("PoWDifficulty(%d, %d, %d) should be %d, is %d",
+				tc.base, tc.recent, tc.target, tc.want, got)
+		}
+	}
+}
+
+func TestSessionTokens(t *testing.T) {
+	kr := auth.NewHMACKeyring("secret")
+	userID := uuid.New()
+	sessionID := uuid.New()
+	claims := auth.NewClaims(userID, auth.RoleUser, auth.WithSession(sessionID))
+	first, err := kr.Sign(claims, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	second, err := kr.Sign(claims, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	firstClaims, err := kr.Parse(first)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	secondClaims, err := kr.Parse(second)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, ok := firstClaims.Session(); !ok || got != sessionID {
+		t.Errorf("session should be '%s', is '%s'", sessionID,
+			firstClaims.SessionID)
+	}
+	if firstClaims.ID == "" || firstClaims.ID == secondClaims.ID {
+		t.Errorf("tokens should have distinct IDs, have '%s' and '%s'",
+			firstClaims.ID, secondClaims.ID)
+	}
+
+	plain, err := kr.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	plainClaims, err := kr.Parse(plain)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := plainClaims.Session(); ok {
+		t.Errorf("token without a session has session '%s'",
+			plainClaims.SessionID)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !auth.IsAPIKey(key) {
+		t.Errorf("'%s' should look like an API key", key)
+	}
+	gotPrefix, err := auth.APIKeyPrefix(key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if gotPrefix != prefix {
+		t.Errorf("prefix should be '%s', is '%s'", prefix, gotPrefix)
+	}
+	otherKey, otherPrefix, err := auth.MakeAPIKey()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if otherKey == key || otherPrefix == prefix {
+		t.Errorf("two API keys should differ: '%s' and '%s'", key, otherKey)
+	}
+
+	jwt, err := auth.MakeJWT(uuid.New(), "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if auth.IsAPIKey(jwt) {
+		t.Errorf("a JWT shouldn't look like an API key")
+	}
+	for _, bad := range []string{"chirpy_", "chirpy_abc_def", "chirpy_" + prefix,
+		"chirpy_" + prefix + "_"} {
+		if _, err := auth.APIKeyPrefix(bad); err == nil {
+			t.Errorf("'%s' should not parse as an API key", bad)
+		}
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "ApiKey "+key)
+	gotKey, err := auth.GetAPIKey(headers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if gotKey != key {
+		t.Errorf("key should be '%s', is '%s'", key, gotKey)
+	}
+	headers.Set("Authorization", "Bearer "+key)
+	if _, err := auth.GetAPIKey(headers); err == nil {
+		t.Errorf("a bearer token shouldn't be taken for an ApiKey header")
+	}
+}
+
+func TestImpersonationTokens(t *testing.T) {
+	kr := auth.NewHMACKeyring("secret")
+	userID := uuid.New()
+	adminID := uuid.New()
+	token, err := kr.Sign(auth.NewClaims(userID, auth.RoleAdmin,
+		auth.WithActor(adminID), auth.ReadOnly()), time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	claims, err := kr.Parse(token)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, ok := claims.Impersonator(); !ok || got != adminID {
+		t.Errorf("impersonator should be '%s', is '%v'", adminID, claims.Act)
+	}
+	if !claims.ReadOnly {
+		t.Errorf("token should be read-only")
+	}
+	if claims.HasScope(auth.ScopeAdmin) {
+		t.Errorf("impersonation token shouldn't have scope '%s'",
+			auth.ScopeAdmin)
+	}
+	if !claims.HasScope(auth.ScopeChirpsWrite) {
+		t.Errorf("impersonation token should have scope '%s'",
+			auth.ScopeChirpsWrite)
+	}
+
+	plainToken, err := kr.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	plain, err := kr.Parse(plainToken)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := plain.Impersonator(); ok || plain.ReadOnly {
+		t.Errorf("plain token shouldn't look impersonated: %v", plain.Act)
+	}
+}
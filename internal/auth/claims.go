@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUsersWrite  = "users:write"
+	ScopeAdmin       = "admin"
+)
+
+var roleScopes = map[string][]string{
+	RoleUser:  {ScopeChirpsWrite, ScopeUsersWrite},
+	RoleAdmin: {ScopeChirpsWrite, ScopeUsersWrite, ScopeAdmin},
+}
+
+// ClientScopes are the scopes a third-party OAuth client can ask a user for.
+// Managing the account itself is left to Chirpy.
+var ClientScopes = []string{ScopeChirpsWrite}
+
+// ScopesForRole returns every scope a user with role gets on login. Unknown
+// roles get none.
+func ScopesForRole(role string) []string {
+	return slices.Clone(roleScopes[role])
+}
+
+// AudienceLoginChallenge marks the short-lived tokens handed out between the
+// password and second-factor steps of a login. Parse refuses them, so they
+// can't be used as access tokens.
+const AudienceLoginChallenge = "chirpy:login-challenge"
+
+// Claims are what Chirpy puts in its access tokens. Scope is a
+// space-separated list, as in OAuth 2.0 (RFC 6749, section 3.3). ClientID is
+// set on tokens issued to a third-party OAuth client, as in RFC 9068, and
+// SessionID on tokens from a login, so they die with the session. Act is set
+// on tokens an admin has had issued to act as someone else, and ReadOnly on
+// those that may only look. Difficulty is only for proof-of-work challenges.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role       string `json:"role,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+	SessionID  string `json:"sid,omitempty"`
+	Act        *Actor `json:"act,omitempty"`
+	ReadOnly   bool   `json:"read_only,omitempty"`
+	Difficulty int    `json:"pow_difficulty,omitempty"`
+}
+
+// An Actor is who's really using a token issued for someone else, as in RFC
+// 8693, section 4.1.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// A TokenOption changes the claims MakeJWT puts in a token.
+type TokenOption func(*Claims)
+
+// WithClient makes a token for an OAuth client, with only the scopes the
+// user granted it.
+func WithClient(clientID string, scopes []string) TokenOption {
+	return func(c *Claims) {
+		c.ClientID = clientID
+		c.Scope = strings.Join(scopes, " ")
+	}
+}
+
+// WithSession ties a token to a login session.
+func WithSession(sessionID uuid.UUID) TokenOption {
+	return func(c *Claims) {
+		c.SessionID = sessionID.String()
+	}
+}
+
+// WithActor makes a token for actorID to act as the token's subject. It
+// never carries the admin scope, even for an admin's account: whoever's
+// impersonating someone can't do anything as them that they couldn't as
+// themselves.
+func WithActor(actorID uuid.UUID) TokenOption {
+	return func(c *Claims) {
+		c.Act = &Actor{Subject: actorID.String()}
+		c.Scope = strings.Join(slices.DeleteFunc(c.Scopes(),
+			func(scope string) bool { return scope == ScopeAdmin }), " ")
+	}
+}
+
+// ReadOnly makes a token that may only be used to look, not to change
+// anything.
+func ReadOnly() TokenOption {
+	return func(c *Claims) {
+		c.ReadOnly = true
+	}
+}
+
+// NewClaims returns the claims for a token for userID, with every scope
+// their role allows, unless opts say otherwise.
+func NewClaims(userID uuid.UUID, role string, opts ...TokenOption) Claims {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: userID.String()},
+		Role:             role,
+		Scope:            strings.Join(ScopesForRole(role), " "),
+	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	return claims
+}
+
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	subjectUUID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("cannot parse UUID: %w", err)
+	}
+	return subjectUUID, nil
+}
+
+// Session returns the login session the token belongs to, if any.
+func (c *Claims) Session() (uuid.UUID, bool) {
+	sessionID, err := uuid.Parse(c.SessionID)
+	return sessionID, err == nil
+}
+
+// Impersonator returns who's acting as the token's subject, if anyone.
+func (c *Claims) Impersonator() (uuid.UUID, bool) {
+	if c.Act == nil {
+		return uuid.Nil, false
+	}
+	actorID, err := uuid.Parse(c.Act.Subject)
+	return actorID, err == nil
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// NewChallengeClaims returns the claims for a token for userID with the given
+// audience, and no scopes.
+func NewChallengeClaims(userID uuid.UUID, audience string) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  userID.String(),
+			Audience: jwt.ClaimStrings{audience},
+		},
+	}
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// A signingKey is one entry in a Keyring. signKey is nil for keys which are
+// only kept around to validate tokens issued before a rotation; notAfter, if
+// set, is when such a key stops being accepted at all.
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	notAfter  time.Time
+}
+
+func (key *signingKey) active(now time.Time) bool {
+	return key.notAfter.IsZero() || now.Before(key.notAfter)
+}
+
+// A Keyring holds every key the server will accept tokens from, plus the one
+// (primary) key it signs new tokens with. Tokens carry the ID of the key that
+// signed them in their 'kid' header.
+type Keyring struct {
+	primary *signingKey
+	keys    []*signingKey
+}
+
+// NewHMACKeyring returns a keyring with a single, ID-less HS256 key; this is
+// the CHIRPY_SECRET setup from before keyrings existed.
+func NewHMACKeyring(secret string) *Keyring {
+	key := &signingKey{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	return &Keyring{primary: key, keys: []*signingKey{key}}
+}
+
+// AcceptHMAC makes the keyring accept (but never sign) ID-less HS256 tokens
+// made with secret, so that moving off a shared secret doesn't log everyone
+// out.
+func (kr *Keyring) AcceptHMAC(secret string) {
+	kr.keys = append(kr.keys, &signingKey{
+		method:    jwt.SigningMethodHS256,
+		verifyKey: []byte(secret),
+	})
+}
+
+type keyringFile struct {
+	Primary string `json:"primary"`
+	Keys    []struct {
+		ID             string    `json:"kid"`
+		Alg            string    `json:"alg"`
+		Secret         string    `json:"secret"`
+		PrivateKeyFile string    `json:"private_key_file"`
+		PublicKeyFile  string    `json:"public_key_file"`
+		NotAfter       time.Time `json:"not_after"`
+	} `json:"keys"`
+}
+
+// LoadKeyring reads a JSON keyring description from path. Key file paths in
+// it are relative to the keyring file itself. See README.md for the format.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keyring: %w", err)
+	}
+	var desc keyringFile
+	err = json.Unmarshal(data, &desc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing keyring: %w", err)
+	}
+	dir := filepath.Dir(path)
+	readPEM := func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return os.ReadFile(name)
+	}
+
+	kr := &Keyring{}
+	seen := map[string]bool{}
+	for _, k := range desc.Keys {
+		if k.ID == "" {
+			return nil, errors.New("keyring entry without a 'kid'")
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate kid in keyring: %s", k.ID)
+		}
+		seen[k.ID] = true
+
+		key := &signingKey{id: k.ID, notAfter: k.NotAfter}
+		var privPEM, pubPEM []byte
+		switch {
+		case k.Alg == jwt.SigningMethodHS256.Alg():
+			if k.Secret == "" {
+				err = errors.New("needs a secret")
+			}
+		case k.PrivateKeyFile != "":
+			privPEM, err = readPEM(k.PrivateKeyFile)
+		case k.PublicKeyFile != "":
+			pubPEM, err = readPEM(k.PublicKeyFile)
+		default:
+			err = errors.New("needs a private_key_file or public_key_file")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.ID, err)
+		}
+
+		switch k.Alg {
+		case jwt.SigningMethodHS256.Alg():
+			key.method = jwt.SigningMethodHS256
+			key.signKey = []byte(k.Secret)
+			key.verifyKey = []byte(k.Secret)
+		case jwt.SigningMethodEdDSA.Alg():
+			key.method = jwt.SigningMethodEdDSA
+			if privPEM != nil {
+				priv, err := jwt.ParseEdPrivateKeyFromPEM(privPEM)
+				if err != nil {
+					return nil, fmt.Errorf("key %s: %w", k.ID, err)
+				}
+				key.signKey = priv
+				key.verifyKey = priv.(ed25519.PrivateKey).Public()
+			} else {
+				key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(pubPEM)
+			}
+		case jwt.SigningMethodRS256.Alg():
+			key.method = jwt.SigningMethodRS256
+			if privPEM != nil {
+				priv, err := jwt.ParseRSAPrivateKeyFromPEM(privPEM)
+				if err != nil {
+					return nil, fmt.Errorf("key %s: %w", k.ID, err)
+				}
+				key.signKey = priv
+				key.verifyKey = &priv.PublicKey
+			} else {
+				key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pubPEM)
+			}
+		default:
+			return nil, fmt.Errorf("key %s: unsupported alg: %q", k.ID, k.Alg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		kr.keys = append(kr.keys, key)
+	}
+
+	for _, key := range kr.keys {
+		if desc.Primary == "" || key.id == desc.Primary {
+			kr.primary = key
+			break
+		}
+	}
+	if kr.primary == nil {
+		return nil, fmt.Errorf("primary key not found in keyring: %q",
+			desc.Primary)
+	}
+	if kr.primary.signKey == nil {
+		return nil, fmt.Errorf("primary key %s has no private key",
+			kr.primary.id)
+	}
+	if !kr.primary.notAfter.IsZero() {
+		return nil, fmt.Errorf("primary key %s can't have a not_after cutoff",
+			kr.primary.id)
+	}
+	return kr, nil
+}
+
+// KeyringFromArg makes a keyring from a command-line argument: "@path" is a
+// keyring file, and anything else a plain HS256 secret.
+func KeyringFromArg(arg string) (*Keyring, error) {
+	if path, ok := strings.CutPrefix(arg, "@"); ok {
+		return LoadKeyring(path)
+	}
+	return NewHMACKeyring(arg), nil
+}
+
+// Sign makes a token from claims with the primary key, filling in the
+// issuer, a unique token ID and the validity period.
+func (kr *Keyring) Sign(claims Claims, expiresIn time.Duration) (string, error) {
+	timeNow := time.Now()
+	claims.Issuer = issuer
+	claims.ID = uuid.NewString()
+	claims.IssuedAt = jwt.NewNumericDate(timeNow)
+	claims.ExpiresAt = jwt.NewNumericDate(timeNow.Add(expiresIn))
+	token := jwt.NewWithClaims(kr.primary.method, claims)
+	if kr.primary.id != "" {
+		token.Header["kid"] = kr.primary.id
+	}
+	ss, err := token.SignedString(kr.primary.signKey)
+	if err != nil {
+		return "", fmt.Errorf("error creating JWT token: %w", err)
+	}
+	return ss, nil
+}
+
+// Parse checks an access token against the keyring, and returns its claims.
+// Tokens with a 'kid' are only checked against that key; tokens without one
+// are checked against every key for their algorithm. Keys past their
+// not_after cutoff are ignored. Tokens with an audience aren't access tokens,
+// and are refused; see ParseFor.
+func (kr *Keyring) Parse(tokenString string) (*Claims, error) {
+	claims, err := kr.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+// ParseFor is Parse for special-purpose tokens, which must have audience.
+func (kr *Keyring) ParseFor(tokenString, audience string) (*Claims, error) {
+	return kr.parse(tokenString, jwt.WithAudience(audience))
+}
+
+func (kr *Keyring) parse(tokenString string,
+	opts ...jwt.ParserOption) (*Claims, error) {
+	opts = append(opts, jwt.WithValidMethods(kr.methods()))
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, kr.keyFunc,
+		opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT: %w", err)
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return nil, errors.New("invalid 'claims' in JWT")
+	}
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("invalid issuer: %v", claims.Issuer)
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// MakeJWT signs a token for userID, with the scopes of an ordinary user
+// unless opts say otherwise.
+func (kr *Keyring) MakeJWT(userID uuid.UUID, expiresIn time.Duration,
+	opts ...TokenOption) (string, error) {
+	return kr.Sign(NewClaims(userID, RoleUser, opts...), expiresIn)
+}
+
+// ValidateJWT checks a token against the keyring (see Parse), and returns the
+// user it was issued to.
+func (kr *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := kr.Parse(tokenString)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return claims.UserID()
+}
+
+func (kr *Keyring) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	now := time.Now()
+	set := jwt.VerificationKeySet{}
+	for _, key := range kr.keys {
+		if !key.active(now) {
+			continue
+		}
+		// Matching on the algorithm as well stops a token from getting an
+		// RSA public key used as an HMAC secret.
+		if key.method.Alg() != token.Method.Alg() {
+			continue
+		}
+		if kid != "" && key.id != kid {
+			continue
+		}
+		set.Keys = append(set.Keys, key.verifyKey)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("no %s key with kid %q", token.Method.Alg(), kid)
+	}
+	return set, nil
+}
+
+func (kr *Keyring) methods() []string {
+	var methods []string
+	seen := map[string]bool{}
+	for _, key := range kr.keys {
+		if !seen[key.method.Alg()] {
+			seen[key.method.Alg()] = true
+			methods = append(methods, key.method.Alg())
+		}
+	}
+	return methods
+}
+
+// JWK is the public half of a keyring key, as per RFC 7517.
+type JWK struct {
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	KeyID   string `json:"kid"`
+	Curve   string `json:"crv,omitempty"`
+	X       string `json:"x,omitempty"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served from /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the active public keys in the keyring. HMAC secrets are, of
+// course, left out.
+func (kr *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding
+	now := time.Now()
+	for _, key := range kr.keys {
+		if !key.active(now) {
+			continue
+		}
+		jwk := JWK{Use: "sig", Alg: key.method.Alg(), KeyID: key.id}
+		switch pub := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = b64.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = b64.EncodeToString(pub.N.Bytes())
+			jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
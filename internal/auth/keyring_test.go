@@ -0,0 +1,241 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, name string, key crypto.PrivateKey) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	err = os.WriteFile(filepath.Join(dir, name), pemBytes, 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func writeKeyring(t *testing.T, dir, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, "keyring.json")
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return path
+}
+
+func TestKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	writeKey(t, dir, "old.pem", rsaKey)
+	writeKey(t, dir, "new.pem", edKey)
+
+	// Before: the RSA key is primary.
+	oldRing, err := auth.LoadKeyring(writeKeyring(t, dir, `{
+		"primary": "old",
+		"keys": [{"kid": "old", "alg": "RS256", "private_key_file": "old.pem"}]
+	}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	userID := uuid.New()
+	oldJWT, err := oldRing.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// After: the Ed25519 key is primary, but the RSA one is still accepted.
+	newRing, err := auth.LoadKeyring(writeKeyring(t, dir, `{
+		"primary": "new",
+		"keys": [
+			{"kid": "new", "alg": "EdDSA", "private_key_file": "new.pem"},
+			{"kid": "old", "alg": "RS256", "private_key_file": "old.pem"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	newJWT, err := newRing.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, token := range []string{oldJWT, newJWT} {
+		decoded, err := newRing.ValidateJWT(token)
+		if err != nil {
+			t.Errorf("token should validate after rotation: %s", err.Error())
+		} else if decoded != userID {
+			t.Errorf("decoded UUID %s, want %s", decoded, userID)
+		}
+	}
+
+	// The old keyring has never heard of the new key.
+	if _, err := oldRing.ValidateJWT(newJWT); err == nil {
+		t.Errorf("token from an unknown key should not validate")
+	}
+
+	jwks := newRing.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS should have 2 keys, has %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].KeyID != "new" || jwks.Keys[0].KeyType != "OKP" ||
+		jwks.Keys[1].KeyID != "old" || jwks.Keys[1].KeyType != "RSA" {
+		t.Errorf("unexpected JWKS: %+v", jwks)
+	}
+}
+
+func TestKeyringAcceptHMAC(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	writeKey(t, dir, "key.pem", edKey)
+	kr, err := auth.LoadKeyring(writeKeyring(t, dir, `{
+		"keys": [{"kid": "k", "alg": "EdDSA", "private_key_file": "key.pem"}]
+	}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	legacyJWT, err := auth.MakeJWT(uuid.New(), "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := kr.ValidateJWT(legacyJWT); err == nil {
+		t.Errorf("HS256 token should not validate without AcceptHMAC")
+	}
+	kr.AcceptHMAC("secret")
+	if _, err := kr.ValidateJWT(legacyJWT); err != nil {
+		t.Errorf("HS256 token should validate with AcceptHMAC: %s", err.Error())
+	}
+	if len(kr.JWKS().Keys) != 1 {
+		t.Errorf("HMAC secrets should never be published")
+	}
+}
+
+func TestKeyringFromArg(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	writeKey(t, dir, "key.pem", edKey)
+	path := writeKeyring(t, dir, `{
+		"primary": "k",
+		"keys": [{"kid": "k", "alg": "EdDSA", "private_key_file": "key.pem"}]
+	}`)
+
+	kr, err := auth.KeyringFromArg("@" + path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(kr.JWKS().Keys) != 1 {
+		t.Errorf("@%s should load the keyring file", path)
+	}
+
+	kr, err = auth.KeyringFromArg("secret")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	legacyJWT, err := auth.MakeJWT(uuid.New(), "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := kr.ValidateJWT(legacyJWT); err != nil {
+		t.Errorf("A plain secret should be an HS256 key: %s", err.Error())
+	}
+	if len(kr.JWKS().Keys) != 0 {
+		t.Errorf("A plain secret should never be published")
+	}
+}
+
+func TestKeyringHMACCutoff(t *testing.T) {
+	dir := t.TempDir()
+	oldRing, err := auth.LoadKeyring(writeKeyring(t, dir, `{
+		"keys": [{"kid": "s1", "alg": "HS256", "secret": "old"}]
+	}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	userID := uuid.New()
+	oldJWT, err := oldRing.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	legacyJWT, err := auth.MakeJWT(userID, "old", time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	rotated := func(cutoff string) *auth.Keyring {
+		kr, err := auth.LoadKeyring(writeKeyring(t, dir, `{
+			"primary": "s2",
+			"keys": [
+				{"kid": "s2", "alg": "HS256", "secret": "new"},
+				{"kid": "s1", "alg": "HS256", "secret": "old",
+				 "not_after": "`+cutoff+`"}
+			]
+		}`))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return kr
+	}
+
+	beforeCutoff := rotated(future)
+	for _, token := range []string{oldJWT, legacyJWT} {
+		if _, err := beforeCutoff.ValidateJWT(token); err != nil {
+			t.Errorf("old secret should be accepted before cutoff: %s",
+				err.Error())
+		}
+	}
+	newJWT, err := beforeCutoff.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := oldRing.ValidateJWT(newJWT); err == nil {
+		t.Errorf("new tokens should be signed with the new secret")
+	}
+
+	afterCutoff := rotated(past)
+	for _, token := range []string{oldJWT, legacyJWT} {
+		if _, err := afterCutoff.ValidateJWT(token); err == nil {
+			t.Errorf("old secret should be rejected after cutoff")
+		}
+	}
+	if _, err := afterCutoff.ValidateJWT(newJWT); err != nil {
+		t.Errorf("new secret should still be accepted: %s", err.Error())
+	}
+
+	_, err = auth.LoadKeyring(writeKeyring(t, dir, `{
+		"keys": [{"kid": "s1", "alg": "HS256", "secret": "old",
+		          "not_after": "`+future+`"}]
+	}`))
+	if err == nil {
+		t.Errorf("primary key with a cutoff should be rejected")
+	}
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const cost = 10
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// A Hasher makes password hashes with one algorithm and set of parameters.
+// Hashes are self-describing, so CheckPasswordHash can check any of them no
+// matter which Hasher is current.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// IsCurrent reports whether hash was made with this algorithm and these
+	// parameters.
+	IsCurrent(hash string) bool
+}
+
+// Argon2idHasher makes PHC-format hashes, like
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// BcryptHasher makes bcrypt hashes, like $2a$10$<salt and hash>.
+type BcryptHasher struct {
+	Cost int
+}
+
+// DefaultHasher follows the second recommended option in RFC 9106.
+var DefaultHasher Hasher = Argon2idHasher{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var passwordHasher = DefaultHasher
+
+// SetPasswordHasher changes the hasher HashPassword uses. It's meant to be
+// called once, at startup.
+func SetPasswordHasher(h Hasher) {
+	passwordHasher = h
+}
+
+// ParseHasher makes a Hasher from a spec like "argon2id", "bcrypt",
+// "argon2id:m=65536,t=3,p=2" or "bcrypt:cost=12". Unset parameters get
+// their defaults.
+func ParseHasher(spec string) (Hasher, error) {
+	name, paramStr, _ := strings.Cut(spec, ":")
+	params := map[string]uint64{}
+	if paramStr != "" {
+		for _, kv := range strings.Split(paramStr, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid hasher parameter: %q", kv)
+			}
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hasher parameter: %q: %w", kv, err)
+			}
+			params[k] = n
+		}
+	}
+
+	switch name {
+	case "argon2id":
+		h := DefaultHasher.(Argon2idHasher)
+		for k, v := range params {
+			switch k {
+			case "m":
+				h.Memory = uint32(v)
+			case "t":
+				h.Iterations = uint32(v)
+			case "p":
+				if v == 0 || v > 255 {
+					return nil, fmt.Errorf("argon2id parallelism out of range: %d", v)
+				}
+				h.Parallelism = uint8(v)
+			default:
+				return nil, fmt.Errorf("unknown argon2id parameter: %q", k)
+			}
+		}
+		if h.Memory < 8*uint32(h.Parallelism) || h.Iterations < 1 {
+			return nil, errors.New("argon2id parameters too small")
+		}
+		return h, nil
+	case "bcrypt":
+		h := BcryptHasher{Cost: cost}
+		for k, v := range params {
+			if k != "cost" {
+				return nil, fmt.Errorf("unknown bcrypt parameter: %q", k)
+			}
+			h.Cost = int(v)
+		}
+		if h.Cost < bcrypt.MinCost || h.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost out of range: %d", h.Cost)
+		}
+		return h, nil
+	}
+	return nil, fmt.Errorf("unknown password hashing algorithm: %q", name)
+}
+
+// HashPassword hashes password with the current hasher.
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// NeedsRehash reports whether hash should be replaced by a fresh one from
+// HashPassword, because the algorithm or its parameters have since changed.
+func NeedsRehash(hash string) bool {
+	return !passwordHasher.IsCurrent(hash)
+}
+
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("not anyone's password")
+	return hash
+})
+
+// FakePasswordCheck takes as long as checking password against a real hash
+// from the current hasher, and does nothing with the result. Doing this when
+// there's no such user keeps logins from revealing which emails exist.
+func FakePasswordCheck(password string) {
+	_ = CheckPasswordHash(dummyHash(), password)
+}
+
+// fakeCheckTime is about how long FakePasswordCheck takes.
+var fakeCheckTime = sync.OnceValue(func() time.Duration {
+	dummyHash()
+	start := time.Now()
+	FakePasswordCheck("not anyone's password either")
+	return time.Since(start)
+})
+
+// CheckLoginPassword is CheckPasswordHash for logins, where a user who
+// doesn't exist gets FakePasswordCheck instead. A hash from an older,
+// cheaper hasher would be checked faster than that, and give away that its
+// user exists, so checking one takes at least as long.
+func CheckLoginPassword(hash, password string) error {
+	start := time.Now()
+	err := CheckPasswordHash(hash, password)
+	if NeedsRehash(hash) {
+		time.Sleep(fakeCheckTime() - time.Since(start))
+	}
+	return err
+}
+
+// CheckPasswordHash checks password against hash, whichever algorithm made
+// it. A wrong password gives ErrPasswordMismatch.
+func CheckPasswordHash(hash, password string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		err = checkArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$2"):
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			err = ErrPasswordMismatch
+		}
+	default:
+		err = errors.New("unknown hash format")
+	}
+	switch {
+	case errors.Is(err, ErrPasswordMismatch):
+		return ErrPasswordMismatch
+	case err != nil:
+		return fmt.Errorf("invalid hash or comparison failed: %w", err)
+	}
+	return nil
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) IsCurrent(hash string) bool {
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && hashCost == h.Cost
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory,
+		h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) IsCurrent(hash string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	return err == nil &&
+		params.Memory == h.Memory &&
+		params.Iterations == h.Iterations &&
+		params.Parallelism == h.Parallelism &&
+		uint32(len(salt)) == h.SaltLength &&
+		uint32(len(key)) == h.KeyLength
+}
+
+func parseArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var h Argon2idHasher
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return h, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return h, nil, nil, fmt.Errorf("malformed argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return h, nil, nil, fmt.Errorf("unsupported argon2id version: %d", version)
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d",
+		&h.Memory, &h.Iterations, &h.Parallelism)
+	if err != nil {
+		return h, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return h, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return h, nil, nil, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	if len(key) == 0 || h.Iterations == 0 || h.Parallelism == 0 {
+		return h, nil, nil, errors.New("malformed argon2id hash")
+	}
+	h.SaltLength = uint32(len(salt))
+	h.KeyLength = uint32(len(key))
+	return h, salt, key, nil
+}
+
+func checkArgon2id(hash, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations,
+		params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
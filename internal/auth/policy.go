@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is as much of a password as bcrypt looks at; it refuses
+// anything longer.
+const bcryptMaxBytes = 72
+
+// PasswordPolicy is what new passwords have to satisfy. MinLength counts
+// characters; MaxLength counts bytes, since that's what bcrypt's limit is
+// in. Breached, if set, is checked too.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Breached  *BreachedList
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: at least eight characters,
+// and as long as the hasher can take.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: bcryptMaxBytes,
+}
+
+var passwordPolicy = DefaultPasswordPolicy
+
+// SetPasswordPolicy changes the policy CheckPasswordPolicy enforces. It's
+// meant to be called once, at startup.
+func SetPasswordPolicy(p PasswordPolicy) error {
+	if p.MinLength < 1 {
+		return errors.New("minimum password length must be at least 1")
+	}
+	if p.MaxLength < p.MinLength {
+		return errors.New("maximum password length is below the minimum")
+	}
+	// Even when the hasher isn't bcrypt, it might be again one day, and
+	// then longer passwords couldn't be rehashed with it.
+	if p.MaxLength > bcryptMaxBytes {
+		return fmt.Errorf("passwords can't be over %d bytes, as bcrypt "+
+			"can't take them", bcryptMaxBytes)
+	}
+	passwordPolicy = p
+	return nil
+}
+
+// A PolicyViolation is one way a password breaks the policy. Code is for
+// programs; Message, for people.
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every way a password breaks the policy.
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password not allowed: " + strings.Join(messages, "; ")
+}
+
+// CheckPasswordPolicy checks a new password for the user with email against
+// the policy. Breaking it gives a *PolicyError; other errors mean the check
+// itself failed.
+func CheckPasswordPolicy(password, email string) error {
+	return passwordPolicy.Check(password, email)
+}
+
+// Check checks a new password for the user with email against p; see
+// CheckPasswordPolicy.
+func (p PasswordPolicy) Check(password, email string) error {
+	var violations []PolicyViolation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Code: "too_short",
+			Message: fmt.Sprintf("must be at least %d characters long",
+				p.MinLength),
+		})
+	}
+	if len(password) > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("must be at most %d bytes long", p.MaxLength),
+		})
+	}
+	if email != "" && strings.EqualFold(strings.TrimSpace(password),
+		strings.TrimSpace(email)) {
+		violations = append(violations, PolicyViolation{
+			Code:    "same_as_email",
+			Message: "must not be your email address",
+		})
+	}
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Code:    "breached",
+				Message: "has appeared in a data breach; choose another",
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// A BreachedList is a directory of SHA-1 hashes of known-breached
+// passwords, in the Pwned Passwords range layout: for each five-character
+// hex prefix, a file (like 21BD1.txt) of the 35-character suffixes of the
+// hashes that start with it, one per line, optionally followed by ":count".
+// That's what the Pwned Passwords downloader writes, and what the range API
+// answers with; only the one small file for a password's prefix is ever read.
+type BreachedList struct {
+	dir string
+}
+
+// breachedPrefixLength is how many hex characters of a hash name its file.
+const breachedPrefixLength = 5
+
+// OpenBreachedList opens the breached-password directory at path.
+func OpenBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password list: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password list %s isn't a directory",
+			path)
+	}
+	return &BreachedList{dir: path}, nil
+}
+
+// Contains reports whether password is on the list. A prefix with no file has
+// no breached passwords.
+func (bl *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	f, err := os.Open(filepath.Join(bl.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading breached password list: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(key), suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading breached password list: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,142 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeBreachedList writes the given passwords' hashes in the range layout,
+// with enough filler that some prefixes have more than one.
+func writeBreachedList(t *testing.T, passwords []string) string {
+	t.Helper()
+	files := map[string][]string{}
+	add := func(pw string, count int) {
+		sum := sha1.Sum([]byte(pw))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		files[hash[:5]] = append(files[hash[:5]],
+			fmt.Sprintf("%s:%d", hash[5:], count))
+	}
+	for _, pw := range passwords {
+		add(pw, 42)
+	}
+	for i := range 5000 {
+		add(fmt.Sprintf("filler %d", i), i)
+	}
+	dir := t.TempDir()
+	for prefix, lines := range files {
+		slices.Sort(lines)
+		err := os.WriteFile(filepath.Join(dir, prefix+".txt"),
+			[]byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return dir
+}
+
+func TestBreachedList(t *testing.T) {
+	breached := []string{"password", "123456", "qwerty", "letmein"}
+	bl, err := auth.OpenBreachedList(writeBreachedList(t, breached))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, pw := range append(breached, "filler 0", "filler 4999") {
+		found, err := bl.Contains(pw)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !found {
+			t.Errorf("'%s' should be on the list", pw)
+		}
+	}
+	for _, pw := range []string{"correct horse battery staple", "filler 5000", ""} {
+		found, err := bl.Contains(pw)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if found {
+			t.Errorf("'%s' should not be on the list", pw)
+		}
+	}
+
+	_, err = auth.OpenBreachedList(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Errorf("a missing list should be refused")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	bl, err := auth.OpenBreachedList(writeBreachedList(t, []string{"password1"}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	policy := auth.DefaultPasswordPolicy
+	policy.Breached = bl
+	for _, testcase := range []struct {
+		password string
+		email    string
+		codes    []string
+	}{
+		{"correct horse battery staple", "a@example.com", nil},
+		{"", "a@example.com", []string{"too_short"}},
+		{"short", "a@example.com", []string{"too_short"}},
+		{strings.Repeat("é", 37), "a@example.com", []string{"too_long"}},
+		{"Me@Example.com", "me@example.com", []string{"same_as_email"}},
+		{"password1", "a@example.com", []string{"breached"}},
+	} {
+		err := policy.Check(testcase.password, testcase.email)
+		var policyErr *auth.PolicyError
+		if testcase.codes == nil {
+			if err != nil {
+				t.Errorf("'%s' should be allowed: %s", testcase.password,
+					err.Error())
+			}
+			continue
+		}
+		if !errors.As(err, &policyErr) {
+			t.Errorf("'%s' should break the policy, got %v",
+				testcase.password, err)
+			continue
+		}
+		var codes []string
+		for _, v := range policyErr.Violations {
+			codes = append(codes, v.Code)
+		}
+		if !slices.Equal(codes, testcase.codes) {
+			t.Errorf("'%s' should break %v, breaks %v", testcase.password,
+				testcase.codes, codes)
+		}
+	}
+}
+
+func TestSetPasswordPolicy(t *testing.T) {
+	defer auth.SetPasswordHasher(auth.DefaultHasher)
+	defer auth.SetPasswordPolicy(auth.DefaultPasswordPolicy)
+
+	auth.SetPasswordHasher(auth.BcryptHasher{Cost: 4})
+	err := auth.SetPasswordPolicy(auth.PasswordPolicy{MinLength: 8, MaxLength: 100})
+	if err == nil {
+		t.Errorf("bcrypt shouldn't allow passwords over 72 bytes")
+	}
+	auth.SetPasswordHasher(auth.DefaultHasher)
+	err = auth.SetPasswordPolicy(auth.PasswordPolicy{MinLength: 8, MaxLength: 100})
+	if err == nil {
+		t.Errorf("argon2id shouldn't allow passwords over 72 bytes either")
+	}
+	err = auth.SetPasswordPolicy(auth.PasswordPolicy{MinLength: 8, MaxLength: 72})
+	if err != nil {
+		t.Errorf("72 bytes should be allowed: %s", err.Error())
+	}
+	err = auth.SetPasswordPolicy(auth.PasswordPolicy{MinLength: 0, MaxLength: 72})
+	if err == nil {
+		t.Errorf("a zero minimum length shouldn't be allowed")
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// A proof-of-work challenge is a signed token; solving it means finding a
+// string that, appended to it after a colon, has a SHA-256 hash starting
+// with its difficulty in zero bits, as in hashcash. Checking a solution is a
+// single hash; finding one takes about 2^difficulty.
+const AudienceSignupChallenge = "chirpy:signup-pow"
+
+// MaxPoWDifficulty is as hard as a challenge gets. Each bit doubles the
+// work; past this, a phone would be at it for minutes.
+const MaxPoWDifficulty = 28
+
+// NewPoWClaims returns the claims for a proof-of-work challenge of the
+// given difficulty. The subject is just a random nonce.
+func NewPoWClaims(difficulty int) Claims {
+	claims := NewChallengeClaims(uuid.New(), AudienceSignupChallenge)
+	claims.Difficulty = difficulty
+	return claims
+}
+
+// PoWDifficulty is base, plus one more bit for every doubling of recent
+// over target: the harder it's being used, the harder it gets.
+func PoWDifficulty(base, recent, target int) int {
+	difficulty := base
+	if target > 0 && recent > target {
+		difficulty += bits.Len(uint((recent - 1) / target))
+	}
+	return min(difficulty, MaxPoWDifficulty)
+}
+
+// VerifyPoW reports whether solution solves challenge at difficulty.
+func VerifyPoW(challenge, solution string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+// SolvePoW finds a solution to challenge at difficulty, the way a client
+// would.
+func SolvePoW(challenge string, difficulty int) string {
+	for n := 0; ; n++ {
+		solution := strconv.Itoa(n)
+		if VerifyPoW(challenge, solution, difficulty) {
+			return solution
+		}
+	}
+}
+
+func leadingZeroBits(b []byte) int {
+	zeros := 0
+	for _, c := range b {
+		if c != 0 {
+			return zeros + bits.LeadingZeros8(c)
+		}
+		zeros += 8
+	}
+	return zeros
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP, as per RFC 6238, with the parameters every authenticator app
+// supports: HMAC-SHA1, 6 digits, 30 second steps.
+const (
+	totpIssuer      = "Chirpy"
+	totpPeriod      = 30
+	totpDigits      = 6
+	totpSecretBytes = 20
+	// How many steps either side of now to accept, for clock drift.
+	totpSkew = 1
+)
+
+var ErrTOTPMismatch = errors.New("TOTP code does not match")
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random, base32-encoded TOTP secret.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretBytes)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	return b32.EncodeToString(buf), nil
+}
+
+// TOTPURI returns the otpauth:// URI for a secret, which authenticator apps
+// take (usually as a QR code) to set themselves up.
+func TOTPURI(secret, accountName string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPStep is the time step t is in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode returns the code for secret at time step step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod), nil
+}
+
+// ValidateTOTP checks code against secret around time t, and returns the
+// step it matched. Steps up to and including lastStep are refused, so a code
+// can only be used once; callers should store the returned step.
+func ValidateTOTP(secret, code string, t time.Time,
+	lastStep int64) (int64, error) {
+	code = strings.TrimSpace(code)
+	now := TOTPStep(t)
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrTOTPMismatch
+}
+
+// GenerateRecoveryCodes returns n single-use codes like "abcd-efgh-ijkl-mnop",
+// 80 random bits each; enough that HashToken is fine for storing them.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for range n {
+		buf := make([]byte, 10)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+		raw := strings.ToLower(b32.EncodeToString(buf))
+		codes = append(codes,
+			raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode undoes whatever a user might do to a recovery code
+// while typing it in, so it can be hashed and looked up.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors from RFC 6238, appendix B, cut down to 6 digits.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+
+func TestTOTPCode(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, v := range vectors {
+		code, err := auth.TOTPCode(rfcSecret, auth.TOTPStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if code != v.code {
+			t.Errorf("at %d: got %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := auth.TOTPStep(now)
+
+	matched, err := auth.ValidateTOTP(rfcSecret, "005924", now, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if matched != step {
+		t.Errorf("matched step %d, want %d", matched, step)
+	}
+
+	// A code from the step before is still fine, for clock drift...
+	prev, err := auth.TOTPCode(rfcSecret, step-1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := auth.ValidateTOTP(rfcSecret, prev, now, 0); err != nil {
+		t.Errorf("code from the previous step should be accepted: %s",
+			err.Error())
+	}
+	// ...but not from well before that.
+	old, err := auth.TOTPCode(rfcSecret, step-3)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := auth.ValidateTOTP(rfcSecret, old, now, 0); err == nil {
+		t.Errorf("code from 3 steps ago should be refused")
+	}
+
+	// And never twice.
+	_, err = auth.ValidateTOTP(rfcSecret, "005924", now, matched)
+	if err != auth.ErrTOTPMismatch {
+		t.Errorf("reused code should be refused, got: %v", err)
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret should be 32 base32 chars, is %d", len(secret))
+	}
+	if _, err := auth.TOTPCode(secret, 1); err != nil {
+		t.Errorf("generated secret should be usable: %s", err.Error())
+	}
+	uri := auth.TOTPURI(secret, "someone@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:someone@example.com?") ||
+		!strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected otpauth URI: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("unexpected recovery code format: %s", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code: %s", code)
+		}
+		seen[code] = true
+	}
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if auth.NormalizeRecoveryCode(typed) !=
+		auth.NormalizeRecoveryCode(codes[0]) {
+		t.Errorf("'%s' should normalize to the same as '%s'", typed, codes[0])
+	}
+}
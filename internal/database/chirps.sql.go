@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,7 +22,7 @@ VALUES (
 	$1,
 	$2
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search
 `
 
 type CreateChirpParams struct {
@@ -37,17 +39,148 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Search,
 	)
 	return i, err
 }
 
-const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+const createChirpRevision = `-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (chirp_id, created_at, replaced_at, body)
+VALUES ($1, $2, CURRENT_TIMESTAMP, $3)
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+type CreateChirpRevisionParams struct {
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+	Body      string
+}
+
+func (q *Queries) CreateChirpRevision(ctx context.Context, arg CreateChirpRevisionParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpRevision, arg.ChirpID, arg.CreatedAt, arg.Body)
+	return err
+}
+
+const deleteChirp = `-- name: DeleteChirp :execrows
+DELETE FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirpByID = `-- name: GetChirpByID :one
+SELECT id, created_at, updated_at, body, user_id, search FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Search,
+	)
+	return i, err
+}
+
+const getChirpByIDForUpdate = `-- name: GetChirpByIDForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, search FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpByIDForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIDForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Search,
+	)
+	return i, err
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT id, chirp_id, created_at, replaced_at, body FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY id ASC
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.CreatedAt,
+			&i.ReplacedAt,
+			&i.Body,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirps = `-- name: ListChirps :many
+SELECT id, created_at, updated_at, body, user_id, search FROM chirps
+WHERE ($1::timestamptz IS NULL
+		OR created_at >= $1)
+	AND ($2::timestamptz IS NULL
+		OR created_at < $2)
+	AND ($3::timestamptz IS NULL
+		OR (created_at, id) > ($3,
+			$4::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type ListChirpsParams struct {
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxResults     int32
+}
+
+// Filters left NULL don't apply. There are separate queries for each order,
+// and for one author's chirps or everyone's, rather than one with those as
+// parameters, so each has a plan that uses its index (chirps_created_at_idx
+// or chirps_user_id_created_at_idx). A page starts just after the
+// (created_at, id) of the last chirp on the one before.
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxResults,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +194,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Search,
 		); err != nil {
 			return nil, err
 		}
@@ -75,13 +209,271 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+const listChirpsByAuthor = `-- name: ListChirpsByAuthor :many
+SELECT id, created_at, updated_at, body, user_id, search FROM chirps
+WHERE user_id = $1
+	AND ($2::timestamptz IS NULL
+		OR created_at >= $2)
+	AND ($3::timestamptz IS NULL
+		OR created_at < $3)
+	AND ($4::timestamptz IS NULL
+		OR (created_at, id) > ($4,
+			$5::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $6
+`
+
+type ListChirpsByAuthorParams struct {
+	AuthorID       uuid.UUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxResults     int32
+}
+
+func (q *Queries) ListChirpsByAuthor(ctx context.Context, arg ListChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByAuthor,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Search,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByAuthorDesc = `-- name: ListChirpsByAuthorDesc :many
+SELECT id, created_at, updated_at, body, user_id, search FROM chirps
+WHERE user_id = $1
+	AND ($2::timestamptz IS NULL
+		OR created_at >= $2)
+	AND ($3::timestamptz IS NULL
+		OR created_at < $3)
+	AND ($4::timestamptz IS NULL
+		OR (created_at, id) < ($4,
+			$5::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $6
+`
+
+type ListChirpsByAuthorDescParams struct {
+	AuthorID       uuid.UUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxResults     int32
+}
+
+func (q *Queries) ListChirpsByAuthorDesc(ctx context.Context, arg ListChirpsByAuthorDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByAuthorDesc,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Search,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search FROM chirps
+WHERE ($1::timestamptz IS NULL
+		OR created_at >= $1)
+	AND ($2::timestamptz IS NULL
+		OR created_at < $2)
+	AND ($3::timestamptz IS NULL
+		OR (created_at, id) < ($3,
+			$4::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type ListChirpsDescParams struct {
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxResults     int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Search,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id,
+	ts_rank(search, to_tsquery('english', $1)) AS rank,
+	ts_headline('english', body, to_tsquery('english', $1),
+		'StartSel=' || chr(2) || ', StopSel=' || chr(3)) AS snippet
+FROM chirps
+WHERE search @@ to_tsquery('english', $1)
+	AND ($2::real IS NULL
+		OR (ts_rank(search, to_tsquery('english', $1)),
+			created_at, id)
+		< ($2, $3::timestamptz,
+			$4::uuid))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $5
+`
+
+type SearchChirpsParams struct {
+	Query          string
+	AfterRank      sql.NullFloat64
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxResults     int32
+}
+
+type SearchChirpsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	Rank      float32
+	Snippet   string
+}
+
+// query is for to_tsquery. The best matches come first, then the newest; a
+// page starts just after the (rank, created_at, id) of the last chirp on the
+// one before. Matches in the snippet are between chr(2) and chr(3), to be
+// swapped for markup once the rest has been escaped.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AfterRank,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $2, updated_at = CURRENT_TIMESTAMP
 WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -89,6 +481,7 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Search,
 	)
 	return i, err
 }
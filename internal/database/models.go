@@ -5,17 +5,157 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scope      string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+}
+
+type AuditEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	Event     string
+	ActorID   uuid.NullUUID
+	Ip        string
+	UserAgent string
+	Details   json.RawMessage
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	Search    interface{}
+}
+
+type ChirpRevision struct {
+	ID         int64
+	ChirpID    uuid.UUID
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+	Body       string
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type LoginThrottle struct {
+	Kind          string
+	Subject       string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type MagicLinkToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	DeviceHash string
+	ExpiresAt  time.Time
+	UsedAt     sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	RedirectUris []string
+	SecretHash   sql.NullString
+}
+
+type OauthGrant struct {
+	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Scope     string
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	RotatedAt sql.NullTime
+}
+
+type Session struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	UserID     uuid.UUID
+	UserAgent  string
+	Ip         string
+	RevokedAt  sql.NullTime
+	CookieHash sql.NullString
+}
+
+type TotpCredential struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Secret    string
+	EnabledAt sql.NullTime
+	LastStep  int64
+}
+
+type UsedPowChallenge struct {
+	ID        string
+	ExpiresAt time.Time
 }
 
 type User struct {
@@ -24,4 +164,6 @@ type User struct {
 	UpdatedAt      time.Time
 	Email          string
 	HashedPassword string
+	Role           string
+	VerifiedAt     sql.NullTime
 }
@@ -0,0 +1,201 @@
+// Package mail sends Chirpy's emails, through whichever Mailer is configured.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// A Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends mail through an SMTP server, with PLAIN auth if Username
+// is set. net/smtp upgrades to TLS whenever the server offers STARTTLS.
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// Send gives up when ctx is done, however far it's got: a server that stops
+// answering doesn't hold it up forever.
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address: %w", err)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("error connecting to SMTP server: %w", err)
+		}
+	}
+	// A deadline in the past makes whatever's blocked on conn fail at once.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	err = m.send(conn, host, msg)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does, over conn.
+func (m SMTPMailer) send(conn net.Conn, host string, msg Message) error {
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("SMTP server doesn't support AUTH")
+		}
+		err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(m.From)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(msg.To)
+	if err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(format(m.From, msg))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// LogMailer doesn't send anything; it just logs each message, for dev.
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer doesn't send anything either; it appends each message to a
+// file, where tests (or people) can find them.
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening mail file: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(format("chirpy", msg), "\r\n"...))
+	if err != nil {
+		return fmt.Errorf("error writing mail file: %w", err)
+	}
+	return nil
+}
+
+// Header values come from users (email addresses, at least), so line breaks
+// are stripped to keep them from adding headers of their own.
+var headerSafe = strings.NewReplacer("\r", "", "\n", "")
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerSafe.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerSafe.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSafe.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// FromEnv sets up the Mailer named by CHIRPY_MAILER: "smtp" (configured by
+// SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM), "file" (writing to
+// CHIRPY_MAIL_FILE), or "log". Emails carry login and password reset tokens,
+// which mustn't end up in a live server's logs, so "log" is only the default
+// for dev; anywhere else, a mailer has to be chosen.
+func FromEnv(dev bool) (Mailer, error) {
+	switch kind := os.Getenv("CHIRPY_MAILER"); kind {
+	case "":
+		if !dev {
+			return nil, errors.New("CHIRPY_MAILER must be set outside dev")
+		}
+		return LogMailer{}, nil
+	case "log":
+		return LogMailer{}, nil
+	case "file":
+		path := os.Getenv("CHIRPY_MAIL_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("CHIRPY_MAIL_FILE must be set for the file mailer")
+		}
+		return &FileMailer{Path: path}, nil
+	case "smtp":
+		m := SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if m.Addr == "" || m.From == "" {
+			return nil, fmt.Errorf("SMTP_ADDR and MAIL_FROM must be set for the smtp mailer")
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer: %q", kind)
+	}
+}
@@ -0,0 +1,98 @@
+package mail_test
+
+import (
+	"chirpy/internal/mail"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	mailer := &mail.FileMailer{Path: path}
+	for _, subject := range []string{"first", "second"} {
+		err := mailer.Send(context.Background(), mail.Message{
+			To:      "someone@example.com",
+			Subject: subject,
+			Body:    "line one\nline two",
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, want := range []string{
+		"To: someone@example.com\r\n",
+		"Subject: first\r\n",
+		"Subject: second\r\n",
+		"\r\n\r\nline one\r\nline two\r\n",
+	} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("mail file should contain %q:\n%s", want, contents)
+		}
+	}
+}
+
+func TestSMTPMailerTimeout(t *testing.T) {
+	// A server that takes connections, then never says anything.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	mailer := mail.SMTPMailer{Addr: listener.Addr().String(),
+		From: "chirpy@example.com"}
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = mailer.Send(ctx, mail.Message{To: "someone@example.com"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send to a silent server: got %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send took %s to give up", elapsed)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CHIRPY_MAILER", "")
+	if m, err := mail.FromEnv(true); err != nil {
+		t.Errorf("default mailer should work on dev: %s", err.Error())
+	} else if _, ok := m.(mail.LogMailer); !ok {
+		t.Errorf("default mailer should be a LogMailer, is %T", m)
+	}
+	if _, err := mail.FromEnv(false); err == nil {
+		t.Errorf("no mailer should be refused outside dev")
+	}
+
+	t.Setenv("CHIRPY_MAILER", "smtp")
+	t.Setenv("SMTP_ADDR", "")
+	if _, err := mail.FromEnv(false); err == nil {
+		t.Errorf("smtp mailer without SMTP_ADDR should be refused")
+	}
+
+	t.Setenv("CHIRPY_MAILER", "pigeon")
+	if _, err := mail.FromEnv(false); err == nil {
+		t.Errorf("unknown mailer should be refused")
+	}
+}
@@ -0,0 +1,103 @@
+// Package pagination pages through lists by keyset: each page starts just
+// after the sort key of the last item on the one before, so it's as cheap to
+// get the thousandth page as the first, and rows added or removed in between
+// don't make items repeat or go missing.
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TimeKey is the sort key of a list ordered by when things were created,
+// with the ID to break ties.
+type TimeKey struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// EncodeCursor turns a sort key into a cursor. Cursors are opaque to
+// clients, who should only ever pass them back.
+func EncodeCursor(key any) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor reads a cursor made by EncodeCursor into key.
+func DecodeCursor(cursor string, key any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if decoder.Decode(key) != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// ParseLimit reads a limit parameter, which can be from 1 to maxLimit; if
+// it's empty, it's def.
+func ParseLimit(raw string, def, maxLimit int) (int, error) {
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("must be from 1 to %d", maxLimit)
+	}
+	return limit, nil
+}
+
+// Next cuts items, fetched with a limit of one more than limit, down to a
+// page, and gives the cursor for the page after it, or "" if this is the
+// last.
+func Next[T, K any](items []T, limit int, key func(T) K) ([]T, string, error) {
+	if len(items) <= limit {
+		return items, "", nil
+	}
+	items = items[:limit]
+	cursor, err := EncodeCursor(key(items[limit-1]))
+	return items, cursor, err
+}
+
+// LinkHeader is a Link header value (RFC 8288) pointing to the next page:
+// the same request, with the cursor parameter set to cursor.
+func LinkHeader(u *url.URL, cursor string) string {
+	query := u.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return "<" + next.String() + `>; rel="next"`
+}
+
+// NextCursorHeader carries the cursor for the next page, for lists whose
+// body is just an array, with nowhere else to put it.
+const NextCursorHeader = "X-Next-Cursor"
+
+// SetNextPage points the response to the request for u at the next page, if
+// there is one (cursor isn't ""), in a Link header and in NextCursorHeader.
+func SetNextPage(h http.Header, u *url.URL, cursor string) {
+	if cursor == "" {
+		return
+	}
+	h.Set("Link", LinkHeader(u, cursor))
+	h.Set(NextCursorHeader, cursor)
+}
@@ -0,0 +1,105 @@
+package pagination_test
+
+import (
+	"chirpy/internal/pagination"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursor(t *testing.T) {
+	key := pagination.TimeKey{
+		CreatedAt: time.Date(2030, 1, 2, 3, 4, 5, 678901000, time.UTC),
+		ID:        uuid.New(),
+	}
+	cursor, err := pagination.EncodeCursor(key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var decoded pagination.TimeKey
+	err = pagination.DecodeCursor(cursor, &decoded)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !decoded.CreatedAt.Equal(key.CreatedAt) || decoded.ID != key.ID {
+		t.Errorf("Decoded %+v, want %+v", decoded, key)
+	}
+
+	for _, bad := range []string{"not base64!", "bm90IGpzb24", "eyJ4IjoxfQ"} {
+		err = pagination.DecodeCursor(bad, &decoded)
+		if !errors.Is(err, pagination.ErrInvalidCursor) {
+			t.Errorf("Cursor %q: got %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"", 50, false},
+		{"1", 1, false},
+		{"200", 200, false},
+		{"0", 0, true},
+		{"201", 0, true},
+		{"ten", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := pagination.ParseLimit(tt.raw, 50, 200)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q): error %v, wantErr %v", tt.raw, err,
+				tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	key := func(n int) int { return n }
+
+	page, cursor, err := pagination.Next([]int{1, 2, 3}, 3, key)
+	if err != nil || len(page) != 3 || cursor != "" {
+		t.Errorf("Last page: got %v, %q, %v", page, cursor, err)
+	}
+
+	page, cursor, err = pagination.Next([]int{1, 2, 3, 4}, 3, key)
+	if err != nil || len(page) != 3 || cursor == "" {
+		t.Fatalf("Full page: got %v, %q, %v", page, cursor, err)
+	}
+	var last int
+	err = pagination.DecodeCursor(cursor, &last)
+	if err != nil || last != 3 {
+		t.Errorf("Cursor decoded to %d, %v; want 3", last, err)
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	u, err := url.Parse("/api/chirps?sort=desc&cursor=old&limit=10")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	got := pagination.LinkHeader(u, "new")
+	want := `</api/chirps?cursor=new&limit=10&sort=desc>; rel="next"`
+	if got != want {
+		t.Errorf("LinkHeader = %s, want %s", got, want)
+	}
+
+	h := http.Header{}
+	pagination.SetNextPage(h, u, "")
+	if len(h) != 0 {
+		t.Errorf("Last page shouldn't get headers: %v", h)
+	}
+	pagination.SetNextPage(h, u, "new")
+	if h.Get("Link") != want || h.Get(pagination.NextCursorHeader) != "new" {
+		t.Errorf("Next page headers: %v", h)
+	}
+}
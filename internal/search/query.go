@@ -0,0 +1,69 @@
+// Package search turns what people type into a search box into Postgres
+// text-search queries.
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("nothing to search for")
+
+// ParseQuery turns q into a query for to_tsquery. Every word has to match;
+// words in double quotes have to match as a phrase, in that order, and a
+// word ending in * matches any word it's the start of. Everything else is
+// taken as space, so no input makes to_tsquery fail.
+//
+// For example, `"black cat" jump*` becomes `(black <-> cat) & jump:*`.
+func ParseQuery(q string) (string, error) {
+	var terms, phrase []string
+	var word strings.Builder
+	inPhrase := false
+	endWord := func(prefix bool) {
+		if word.Len() == 0 {
+			return
+		}
+		lexeme := word.String()
+		word.Reset()
+		if prefix {
+			lexeme += ":*"
+		}
+		if inPhrase {
+			phrase = append(phrase, lexeme)
+		} else {
+			terms = append(terms, lexeme)
+		}
+	}
+	endPhrase := func() {
+		if len(phrase) > 0 {
+			terms = append(terms, "("+strings.Join(phrase, " <-> ")+")")
+		}
+		phrase = nil
+	}
+
+	for _, r := range q {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case r == '*':
+			endWord(true)
+		case r == '"':
+			endWord(false)
+			if inPhrase {
+				endPhrase()
+			}
+			inPhrase = !inPhrase
+		default:
+			endWord(false)
+		}
+	}
+	// A quote that's never closed runs to the end.
+	endWord(false)
+	endPhrase()
+
+	if len(terms) == 0 {
+		return "", ErrEmptyQuery
+	}
+	return strings.Join(terms, " & "), nil
+}
@@ -0,0 +1,40 @@
+package search_test
+
+import (
+	"chirpy/internal/search"
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"cat", "cat"},
+		{"black cat", "black & cat"},
+		{`"black cat"`, "(black <-> cat)"},
+		{`"black cat" jump*`, "(black <-> cat) & jump:*"},
+		{`"the quick bro*`, "(the <-> quick <-> bro:*)"},
+		{"cat's & dog | !bird", "cat & s & dog & bird"},
+		{"(fish):* <-> 'chips'", "fish & chips"},
+		{"Café 42", "Café & 42"},
+	}
+	for _, tt := range tests {
+		got, err := search.ParseQuery(tt.q)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %s", tt.q, err.Error())
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseQuery(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+
+	for _, q := range []string{"", "   ", `""`, "*", "&|!()"} {
+		_, err := search.ParseQuery(q)
+		if !errors.Is(err, search.ErrEmptyQuery) {
+			t.Errorf("ParseQuery(%q): got %v, want ErrEmptyQuery", q, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Other services check Chirpy's access tokens with token introspection (RFC
+// 7662), rather than validating them themselves, since only Chirpy knows
+// whether a token's session or app has been revoked since it was issued.
+// They authenticate as confidential OAuth clients, which have to be listed
+// in CHIRPY_INTROSPECTION_CLIENTS; any other app could otherwise learn about
+// every token it saw.
+
+// parseIntrospectionClients parses a comma-separated list of client IDs.
+func parseIntrospectionClients(raw string) ([]uuid.UUID, error) {
+	var clients []uuid.UUID
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		clientID, err := uuid.Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client ID %q: %w", field, err)
+		}
+		clients = append(clients, clientID)
+	}
+	return clients, nil
+}
+
+// introspectToken returns the claims of token if it's a live access token,
+// or nil if it isn't. Unlike authenticate, it leaves the token's session
+// alone: the request comes from another service, not the token's holder.
+func (cfg *apiConfig) introspectToken(ctx context.Context,
+	token string) (*auth.Claims, error) {
+	claims, err := cfg.keyring.Parse(token)
+	if err != nil {
+		return nil, nil
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, nil
+	}
+	if claims.ClientID != "" {
+		err = cfg.checkClientToken(ctx, userID, claims)
+		if errors.Is(err, errClientRevoked) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sessionID, ok := claims.Session(); ok {
+		_, err = cfg.liveSession(ctx, sessionID, userID)
+		if errors.Is(err, errNoSession) || errors.Is(err, errSessionRevoked) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// introspection is the answer to an introspection request (RFC 7662,
+// section 2.2).
+type introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// Act names the admin using an impersonation token.
+	Act      *auth.Actor `json:"act,omitempty"`
+	ReadOnly bool        `json:"read_only,omitempty"`
+}
+
+// newIntrospection describes a live token with claims, or, if claims is
+// nil, one that isn't, about which nothing else is said.
+func newIntrospection(claims *auth.Claims) introspection {
+	if claims == nil {
+		return introspection{Active: false}
+	}
+	response := introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: "Bearer",
+		Sub:       claims.Subject,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		SessionID: claims.SessionID,
+		Role:      claims.Role,
+		Act:       claims.Act,
+		ReadOnly:  claims.ReadOnly,
+	}
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+	return response
+}
+
+func (cfg *apiConfig) handlerIntrospect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	err := r.ParseForm()
+	if err != nil {
+		respondOAuthError(w, 400, "invalid_request", err.Error())
+		return
+	}
+	client, err := cfg.authenticateClient(r)
+	if errors.Is(err, errInvalidClient) {
+		respondOAuthError(w, 401, "invalid_client", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching client: %s", err.Error())
+		respondOAuthError(w, 500, "server_error", "error fetching client")
+		return
+	}
+	if !client.SecretHash.Valid ||
+		!slices.Contains(cfg.introspectionClients, client.ID) {
+		log.Printf("Client %s tried to introspect a token", client.ID)
+		respondOAuthError(w, 403, "unauthorized_client",
+			"client may not introspect tokens")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, 400, "invalid_request", "no token given")
+		return
+	}
+
+	// Refresh tokens and API keys aren't introspectable, and, like anything
+	// else that isn't a live access token, come back inactive.
+	claims, err := cfg.introspectToken(r.Context(), token)
+	if err != nil {
+		log.Printf("Error introspecting token: %s", err.Error())
+		respondOAuthError(w, 500, "server_error", "error checking token")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, newIntrospection(claims))
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestParseIntrospectionClients(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	clients, err := parseIntrospectionClients(" " + a.String() + ",," +
+		b.String() + " ")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(clients) != 2 || clients[0] != a || clients[1] != b {
+		t.Errorf("Got %v, want [%s %s]", clients, a, b)
+	}
+	clients, err = parseIntrospectionClients("")
+	if err != nil || len(clients) != 0 {
+		t.Errorf("Empty list: got %v, %v", clients, err)
+	}
+	_, err = parseIntrospectionClients(a.String() + ",not-a-uuid")
+	if err == nil {
+		t.Errorf("An invalid client ID should be refused")
+	}
+}
+
+func TestNewIntrospection(t *testing.T) {
+	// Nothing at all is said about an inactive token.
+	data, err := json.Marshal(newIntrospection(nil))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(data) != `{"active":false}` {
+		t.Errorf("Inactive token: got %s", data)
+	}
+
+	userID, adminID, sessionID := uuid.New(), uuid.New(), uuid.New()
+	issued := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	claims := auth.NewClaims(userID, auth.RoleAdmin,
+		auth.WithSession(sessionID), auth.WithActor(adminID))
+	claims.IssuedAt = jwt.NewNumericDate(issued)
+	claims.ExpiresAt = jwt.NewNumericDate(issued.Add(time.Hour))
+	got := newIntrospection(&claims)
+	if !got.Active || got.TokenType != "Bearer" {
+		t.Errorf("Live token: got %+v", got)
+	}
+	if got.Sub != userID.String() || got.SessionID != sessionID.String() ||
+		got.Role != auth.RoleAdmin {
+		t.Errorf("Wrong subject, session or role: %+v", got)
+	}
+	if got.Iat != issued.Unix() || got.Exp != issued.Add(time.Hour).Unix() {
+		t.Errorf("Wrong times: iat %d, exp %d", got.Iat, got.Exp)
+	}
+	if got.Act == nil || got.Act.Subject != adminID.String() {
+		t.Errorf("Impersonation token should name the admin: %+v", got.Act)
+	}
+	if got.Scope != claims.Scope {
+		t.Errorf("Scope = %q, want %q", got.Scope, claims.Scope)
+	}
+}
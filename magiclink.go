@@ -0,0 +1,255 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Users can log in without a password by asking for a link by email. The
+// link only works on the device that asked for it: that device is given a
+// secret (in a cookie, and in the response, for clients without cookies)
+// that has to come back with the link's token. Someone who only gets hold
+// of the email can't use it.
+const (
+	magicLinkExpiry       = 15 * time.Minute
+	magicLinkDeviceCookie = "__Host-chirpy_magic_device"
+	// Links are limited like verification emails, so the endpoint can't be
+	// used to flood someone's inbox.
+	magicLinkInterval   = time.Minute
+	magicLinkDailyLimit = 10
+)
+
+// magicLinkURL is the link mailed for token, to the web app's page that
+// redeems it. The token goes in the fragment, so it isn't sent to the
+// server, or kept in its logs, when the link's opened.
+func magicLinkURL(baseURL, token string) string {
+	return baseURL + "/app/login/magic/#token=" + url.QueryEscape(token)
+}
+
+// magicLinkDeviceToken is the device token a redeem request came with: the
+// one in its body, if given, or else the one in its cookie.
+func magicLinkDeviceToken(r *http.Request, given string) string {
+	if given != "" {
+		return given
+	}
+	if cookie, err := r.Cookie(magicLinkDeviceCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// magicLinkAllowed reports whether userID can be sent another link yet.
+func (cfg *apiConfig) magicLinkAllowed(r *http.Request,
+	userID uuid.UUID) (bool, error) {
+	recent, err := cfg.db.CountMagicLinkTokensSince(r.Context(),
+		database.CountMagicLinkTokensSinceParams{
+			UserID:    userID,
+			CreatedAt: time.Now().Add(-magicLinkInterval),
+		})
+	if err != nil || recent > 0 {
+		return false, err
+	}
+	today, err := cfg.db.CountMagicLinkTokensSince(r.Context(),
+		database.CountMagicLinkTokensSinceParams{
+			UserID:    userID,
+			CreatedAt: time.Now().Add(-24 * time.Hour),
+		})
+	return today < magicLinkDailyLimit, err
+}
+
+func (cfg *apiConfig) handlerMagicLink(w http.ResponseWriter, r *http.Request) {
+	type MLReq struct {
+		Email string `json:"email"`
+	}
+	type Response struct {
+		DeviceToken string `json:"device_token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := MLReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	// The answer's the same whether or not there's such a user, or a link
+	// was actually sent, so this can't be used to find out who has an
+	// account.
+	deviceToken, err := auth.MakeToken()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	respond := func() {
+		http.SetCookie(w, &http.Cookie{
+			Name:     magicLinkDeviceCookie,
+			Value:    deviceToken,
+			Path:     "/",
+			MaxAge:   int(magicLinkExpiry.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		err := respondWithJSON(w, http.StatusAccepted,
+			Response{DeviceToken: deviceToken})
+		if err != nil {
+			errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+			log.Println(errorStr)
+		}
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), request.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("Magic link requested for unknown email.")
+		respond()
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	allowed, err := cfg.magicLinkAllowed(r, user.ID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error checking magic links: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if !allowed {
+		log.Printf("Too many magic links for user %s; not sending another",
+			user.ID)
+		respond()
+		return
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	err = cfg.db.CreateMagicLinkToken(r.Context(),
+		database.CreateMagicLinkTokenParams{
+			TokenHash:  auth.HashToken(token),
+			UserID:     user.ID,
+			DeviceHash: auth.HashToken(deviceToken),
+			ExpiresAt:  time.Now().Add(magicLinkExpiry),
+		})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error creating magic link: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	cfg.audit(r, auditMagicLinkRequest, user.ID, nil)
+
+	cfg.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Log in to Chirpy",
+		Body: "Someone (hopefully you) asked to log in to Chirpy without a " +
+			"password.\nTo log in, open this link within the next 15 minutes, " +
+			"on the same device you asked from:\n\n" +
+			"    " + magicLinkURL(cfg.baseURL, token) + "\n\n" +
+			"or use this token:\n\n" +
+			"    " + token + "\n\n" +
+			"If it wasn't you, you can ignore this email.\n",
+	})
+	respond()
+}
+
+// handlerMagicLinkRedeem logs in with a magic link's token. It answers just
+// as handlerLogin does, including asking for a second factor if the user has
+// 2FA on.
+func (cfg *apiConfig) handlerMagicLinkRedeem(w http.ResponseWriter, r *http.Request) {
+	type MLRReq struct {
+		Token            string `json:"token"`
+		DeviceToken      string `json:"device_token"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		UseCookie        bool   `json:"use_cookie"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := MLRReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if request.ExpiresInSeconds <= 0 ||
+		request.ExpiresInSeconds > defaultExpiryInSeconds {
+		request.ExpiresInSeconds = defaultExpiryInSeconds
+	}
+	request.DeviceToken = magicLinkDeviceToken(r, request.DeviceToken)
+
+	// A token tried from the wrong device isn't used up, so the right one
+	// can still have it.
+	magicLink, err := cfg.db.UseMagicLinkToken(r.Context(),
+		database.UseMagicLinkTokenParams{
+			TokenHash:  auth.HashToken(request.Token),
+			DeviceHash: auth.HashToken(request.DeviceToken),
+		})
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("Invalid magic link in login attempt.")
+		cfg.audit(r, auditLoginFailure, uuid.Nil, map[string]any{
+			"reason": "bad_magic_link",
+		})
+		http.Error(w, "Invalid or expired link, or it was asked for on "+
+			"another device.", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error using magic link: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   magicLinkDeviceCookie,
+		Path:   "/",
+		MaxAge: -1,
+		Secure: true,
+	})
+
+	user, err := cfg.db.GetUserByID(r.Context(), magicLink.UserID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	// The link stands in for the password, not the second factor.
+	twoFactor, err := cfg.hasTwoFactor(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error checking for 2FA: %s", err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		cfg.respondWithChallenge(w, user)
+		return
+	}
+	cfg.clearLoginFailures(r.Context(), user.Email)
+
+	cfg.respondWithLogin(w, r, user,
+		time.Second*time.Duration(request.ExpiresInSeconds), request.UseCookie)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMagicLinkURL(t *testing.T) {
+	link := magicLinkURL("https://chirpy.example", "abc123")
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if u.Path != "/app/login/magic/" || u.RawQuery != "" {
+		t.Errorf("Link %s should go to the magic link page, with no query",
+			link)
+	}
+	// The token mustn't be anywhere the server would see it.
+	fragment, err := url.ParseQuery(u.Fragment)
+	if err != nil || fragment.Get("token") != "abc123" {
+		t.Errorf("Link %s should have the token in its fragment", link)
+	}
+}
+
+func TestMagicLinkDeviceToken(t *testing.T) {
+	withCookie := httptest.NewRequest(http.MethodPost, "/api/login/magic/redeem",
+		nil)
+	withCookie.AddCookie(&http.Cookie{Name: magicLinkDeviceCookie,
+		Value: "from-cookie"})
+	without := httptest.NewRequest(http.MethodPost, "/api/login/magic/redeem",
+		nil)
+
+	tests := []struct {
+		name  string
+		r     *http.Request
+		given string
+		want  string
+	}{
+		{"body only", without, "from-body", "from-body"},
+		{"cookie only", withCookie, "", "from-cookie"},
+		{"body over cookie", withCookie, "from-body", "from-body"},
+		{"neither", without, "", ""},
+	}
+	for _, tt := range tests {
+		if got := magicLinkDeviceToken(tt.r, tt.given); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
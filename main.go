@@ -3,12 +3,16 @@ package main
 import (
 	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"chirpy/internal/pagination"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -21,14 +25,35 @@ import (
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	dbConn         *sql.DB
 	db             *database.Queries
 	platform       string
-	secret         string
+	keyring        *auth.Keyring
+	// trustedProxies is how many proxies in front of the server add
+	// themselves to X-Forwarded-For.
+	trustedProxies int
+	mailer         mail.Mailer
+	// requireVerified keeps users from chirping until they've verified
+	// their email address.
+	requireVerified bool
+	// baseURL is where Chirpy is, as seen from outside, for links in emails.
+	baseURL         string
+	signupPoW       signupPoW
+	chirpEditWindow time.Duration
+	// introspectionClients are the OAuth clients allowed to introspect
+	// tokens.
+	introspectionClients []uuid.UUID
 }
 
 const maxChirpLength = 140
 const defaultExpiryInSeconds = 3600
 
+// Chirps are listed a page at a time.
+const (
+	defaultChirpPageSize = 50
+	maxChirpPageSize     = 200
+)
+
 func main() {
 	var apiCfg apiConfig
 
@@ -44,9 +69,75 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Couldn't conect to DB: %s", err.Error())
 		return
 	}
+	apiCfg.dbConn = db
 	apiCfg.db = database.New(db)
 	apiCfg.platform = os.Getenv("PLATFORM")
-	apiCfg.secret = os.Getenv("CHIRPY_SECRET")
+	apiCfg.trustedProxies, err = trustedProxiesFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up proxies: %s", err.Error())
+		return
+	}
+	apiCfg.requireVerified = os.Getenv("CHIRPY_REQUIRE_VERIFIED") == "true"
+	apiCfg.baseURL = strings.TrimSuffix(os.Getenv("CHIRPY_BASE_URL"), "/")
+	if apiCfg.baseURL == "" {
+		apiCfg.baseURL = "http://localhost:8080"
+	}
+	apiCfg.introspectionClients, err = parseIntrospectionClients(
+		os.Getenv("CHIRPY_INTROSPECTION_CLIENTS"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up introspection: %s",
+			err.Error())
+		return
+	}
+	secret := os.Getenv("CHIRPY_SECRET")
+	if keyringPath := os.Getenv("CHIRPY_KEYRING"); keyringPath != "" {
+		apiCfg.keyring, err = auth.LoadKeyring(keyringPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't load keyring: %s", err.Error())
+			return
+		}
+		// Keep accepting tokens signed with the old shared secret, if
+		// there still is one, until they've all expired.
+		if secret != "" {
+			apiCfg.keyring.AcceptHMAC(secret)
+		}
+	} else {
+		apiCfg.keyring = auth.NewHMACKeyring(secret)
+	}
+
+	if hasherSpec := os.Getenv("CHIRPY_PASSWORD_HASHER"); hasherSpec != "" {
+		hasher, err := auth.ParseHasher(hasherSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't set up password hashing: %s",
+				err.Error())
+			return
+		}
+		auth.SetPasswordHasher(hasher)
+	}
+	err = setPasswordPolicyFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up password policy: %s",
+			err.Error())
+		return
+	}
+	apiCfg.signupPoW, err = signupPoWFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up signup proof of work: %s",
+			err.Error())
+		return
+	}
+	apiCfg.chirpEditWindow, err = chirpEditWindowFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up chirp editing: %s",
+			err.Error())
+		return
+	}
+
+	apiCfg.mailer, err = mail.FromEnv(apiCfg.platform == "dev")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up mail: %s", err.Error())
+		return
+	}
 
 	srv := http.Server{}
 	srv.Addr = ":8080"
@@ -54,8 +145,30 @@ func main() {
 	smux.Handle("/app/",
 		apiCfg.middlewareMetricsInc(http.StripPrefix(
 			"/app", http.FileServer(http.Dir("./app/")))))
-	smux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
-	smux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	// Resetting the database is only for development, and has to work on a
+	// fresh one, before there's any admin to do it.
+	if apiCfg.platform == "dev" {
+		smux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	}
+	smux.Handle("GET /admin/metrics",
+		apiCfg.middlewareRequireScope(auth.ScopeAdmin,
+			apiCfg.handlerMetrics))
+	smux.Handle("PUT /admin/users/{id}/role",
+		apiCfg.middlewareRequireScope(auth.ScopeAdmin,
+			apiCfg.handlerSetRole))
+	smux.Handle("GET /admin/lockouts",
+		apiCfg.middlewareRequireScope(auth.ScopeAdmin,
+			apiCfg.handlerListLockouts))
+	smux.Handle("DELETE /admin/lockouts/{kind}/{subject}",
+		apiCfg.middlewareRequireScope(auth.ScopeAdmin,
+			apiCfg.handlerClearLockout))
+	smux.Handle("GET /admin/audit",
+		apiCfg.middlewareRequireScope(auth.ScopeAdmin,
+			apiCfg.handlerListAuditEvents))
+	smux.Handle("POST /admin/users/{id}/impersonate",
+		apiCfg.middlewareRequireScope(auth.ScopeAdmin,
+			apiCfg.handlerImpersonate))
+	smux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 	smux.HandleFunc("GET /api/healthz",
 		func(rw http.ResponseWriter, req *http.Request) {
 			rw.Header().Add("Content-Type", "text/plain; charset=utf-8")
@@ -68,10 +181,77 @@ func main() {
 		})
 	smux.HandleFunc("POST /api/validate_chirp", handlerValidate)
 	smux.HandleFunc("POST /api/users", apiCfg.handlerUseradd)
+	smux.HandleFunc("GET /api/users/challenge", apiCfg.handlerSignupChallenge)
+	smux.Handle("PUT /api/users",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite, apiCfg.handlerUserUpdate))
+	smux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	smux.Handle("POST /api/users/verify/resend",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerResendVerification))
 	smux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
-	smux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpadd)
+	smux.HandleFunc("POST /api/login/2fa", apiCfg.handlerLogin2FA)
+	smux.HandleFunc("POST /api/login/magic", apiCfg.handlerMagicLink)
+	smux.HandleFunc("POST /api/login/magic/redeem",
+		apiCfg.handlerMagicLinkRedeem)
+	smux.Handle("POST /api/2fa/totp",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerTOTPEnroll))
+	smux.Handle("POST /api/2fa/totp/confirm",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerTOTPConfirm))
+	smux.Handle("DELETE /api/2fa/totp",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerTOTPDisable))
+	smux.HandleFunc("POST /api/password_reset", apiCfg.handlerPasswordReset)
+	smux.HandleFunc("POST /api/password_reset/confirm",
+		apiCfg.handlerPasswordResetConfirm)
+	smux.HandleFunc("GET /oauth/authorize", apiCfg.handlerOAuthAuthorize)
+	smux.HandleFunc("POST /oauth/authorize", apiCfg.handlerOAuthConsent)
+	smux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+	smux.HandleFunc("POST /api/introspect", apiCfg.handlerIntrospect)
+	smux.Handle("POST /api/oauth/clients",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerOAuthClientCreate))
+	smux.Handle("GET /api/oauth/authorizations",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerListAuthorizations))
+	smux.Handle("DELETE /api/oauth/authorizations/{client_id}",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerRevokeAuthorization))
+	smux.Handle("GET /api/sessions",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerListSessions))
+	smux.Handle("DELETE /api/sessions",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerRevokeOtherSessions))
+	smux.Handle("DELETE /api/sessions/{id}",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerRevokeSession))
+	smux.Handle("POST /api/keys",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerAPIKeyCreate))
+	smux.Handle("GET /api/keys",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerListAPIKeys))
+	smux.Handle("DELETE /api/keys/{id}",
+		apiCfg.middlewareRequireScope(auth.ScopeUsersWrite,
+			apiCfg.handlerDeleteAPIKey))
+	smux.HandleFunc("POST /api/logout", apiCfg.handlerLogout)
+	smux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
+	smux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	smux.Handle("POST /api/chirps",
+		apiCfg.middlewareRequireScope(auth.ScopeChirpsWrite, apiCfg.handlerChirpadd))
 	smux.HandleFunc("GET /api/chirps", apiCfg.handlerAllChirps)
+	smux.HandleFunc("GET /api/chirps/search", apiCfg.handlerChirpSearch)
 	smux.HandleFunc("GET /api/chirps/{id}", apiCfg.handlerChirp)
+	smux.Handle("DELETE /api/chirps/{id}",
+		apiCfg.middlewareRequireScope(auth.ScopeChirpsWrite,
+			apiCfg.handlerChirpDelete))
+	smux.Handle("PATCH /api/chirps/{id}",
+		apiCfg.middlewareRequireScope(auth.ScopeChirpsWrite,
+			apiCfg.handlerChirpEdit))
+	smux.HandleFunc("GET /api/chirps/{id}/revisions",
+		apiCfg.handlerChirpRevisions)
 	srv.Handler = smux
 	err = srv.ListenAndServe()
 	if err != nil {
@@ -107,6 +287,10 @@ func (cfg *apiConfig) handlerChirp(w http.ResponseWriter, r *http.Request) {
 	}
 	// DB query
 	dbchirp, err := cfg.db.GetChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such chirp.", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		errorStr := fmt.Sprintf("Error fetching Chirp: %s", err.Error())
 		log.Println(errorStr)
@@ -128,6 +312,170 @@ func (cfg *apiConfig) handlerChirp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// canDeleteChirp reports whether whoever made the request with ra can
+// delete chirp: its author can, and so can admins.
+func canDeleteChirp(ra requestAuth, chirp database.Chirp) bool {
+	if chirp.UserID == ra.UserID {
+		return true
+	}
+	return ra.Claims != nil && ra.Claims.HasScope(auth.ScopeAdmin)
+}
+
+// handlerChirpDelete deletes a chirp, if it's the caller's, or the caller's
+// an admin.
+func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request) {
+	ra := authFromContext(r.Context())
+	reqID := r.PathValue("id")
+	chirpID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid Chirp ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	dbchirp, err := cfg.db.GetChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such chirp.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching Chirp: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	byAdmin := dbchirp.UserID != ra.UserID
+	if !canDeleteChirp(ra, dbchirp) {
+		log.Printf("User %s tried to delete chirp %s of user %s", ra.UserID,
+			dbchirp.ID, dbchirp.UserID)
+		http.Error(w, "Forbidden: not your chirp", http.StatusForbidden)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteChirp(r.Context(), dbchirp.ID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error deleting Chirp: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	// Someone else got there first.
+	if deleted == 0 {
+		http.Error(w, "No such chirp.", http.StatusNotFound)
+		return
+	}
+	log.Printf("User %s deleted chirp %s", ra.UserID, dbchirp.ID)
+	cfg.audit(r, auditChirpDelete, ra.UserID, map[string]any{
+		"chirp_id":  dbchirp.ID,
+		"author_id": dbchirp.UserID,
+		"by_admin":  byAdmin,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// A paramError is a query parameter that couldn't be used.
+type paramError struct {
+	name string
+	err  error
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("Invalid %s: %s", e.name, e.err.Error())
+}
+
+// chirpFilter is which chirps GET /api/chirps asks for, and in what order.
+type chirpFilter struct {
+	params database.ListChirpsParams
+	author uuid.NullUUID
+	desc   bool
+	limit  int
+}
+
+// parseChirpFilter reads a chirpFilter from the query: author_id, since and
+// until (RFC 3339; since is inclusive, until isn't), sort=asc (the default)
+// or desc, limit and cursor. A bad parameter gives a *paramError.
+func parseChirpFilter(query url.Values) (chirpFilter, error) {
+	var filter chirpFilter
+	var err error
+	filter.limit, err = pagination.ParseLimit(query.Get("limit"),
+		defaultChirpPageSize, maxChirpPageSize)
+	if err != nil {
+		return filter, &paramError{"limit", err}
+	}
+	// One more than asked for, to tell whether there's another page.
+	filter.params.MaxResults = int32(filter.limit + 1)
+	if cursor := query.Get("cursor"); cursor != "" {
+		var after pagination.TimeKey
+		err = pagination.DecodeCursor(cursor, &after)
+		if err != nil {
+			return filter, &paramError{"cursor", err}
+		}
+		filter.params.AfterCreatedAt = sql.NullTime{Time: after.CreatedAt,
+			Valid: true}
+		filter.params.AfterID = uuid.NullUUID{UUID: after.ID, Valid: true}
+	}
+	if raw := query.Get("author_id"); raw != "" {
+		filter.author.UUID, err = uuid.Parse(raw)
+		if err != nil {
+			return filter, &paramError{"author_id", err}
+		}
+		filter.author.Valid = true
+	}
+	for _, timeParam := range []struct {
+		name  string
+		value *sql.NullTime
+	}{
+		{"since", &filter.params.Since},
+		{"until", &filter.params.Until},
+	} {
+		raw := query.Get(timeParam.name)
+		if raw == "" {
+			continue
+		}
+		timeParam.value.Time, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, &paramError{timeParam.name, err}
+		}
+		timeParam.value.Valid = true
+	}
+	switch query.Get("sort") {
+	case "", "asc":
+	case "desc":
+		filter.desc = true
+	default:
+		return filter, &paramError{"sort", errors.New("must be asc or desc")}
+	}
+	return filter, nil
+}
+
+// list fetches a page of the chirps f asks for. Each combination of author
+// and order has its own query, so each gets a plan that uses the right
+// index.
+func (f chirpFilter) list(ctx context.Context,
+	q *database.Queries) ([]database.Chirp, error) {
+	byAuthor := database.ListChirpsByAuthorParams{
+		AuthorID:       f.author.UUID,
+		Since:          f.params.Since,
+		Until:          f.params.Until,
+		AfterCreatedAt: f.params.AfterCreatedAt,
+		AfterID:        f.params.AfterID,
+		MaxResults:     f.params.MaxResults,
+	}
+	switch {
+	case f.author.Valid && f.desc:
+		return q.ListChirpsByAuthorDesc(ctx,
+			database.ListChirpsByAuthorDescParams(byAuthor))
+	case f.author.Valid:
+		return q.ListChirpsByAuthor(ctx, byAuthor)
+	case f.desc:
+		return q.ListChirpsDesc(ctx, database.ListChirpsDescParams(f.params))
+	default:
+		return q.ListChirps(ctx, f.params)
+	}
+}
+
 func (cfg *apiConfig) handlerAllChirps(w http.ResponseWriter, r *http.Request) {
 	type Chirp struct {
 		ID         string    `json:"id"`
@@ -137,7 +485,13 @@ func (cfg *apiConfig) handlerAllChirps(w http.ResponseWriter, r *http.Request) {
 		UserID     string    `json:"user_id"`
 	}
 
-	dbchirps, err := cfg.db.GetAllChirps(r.Context())
+	filter, err := parseChirpFilter(r.URL.Query())
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	dbchirps, err := filter.list(r.Context(), cfg.db)
 	if err != nil {
 		errorStr := fmt.Sprintf("Error fetching chirps: %s", err.Error())
 		log.Println(errorStr)
@@ -145,6 +499,17 @@ func (cfg *apiConfig) handlerAllChirps(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dbchirps, next, err := pagination.Next(dbchirps, filter.limit,
+		func(c database.Chirp) pagination.TimeKey {
+			return pagination.TimeKey{CreatedAt: c.CreatedAt, ID: c.ID}
+		})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error making cursor: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
 	chirps := []Chirp{}
 	for _, dbchirp := range dbchirps {
 		chirps = append(chirps,
@@ -156,6 +521,9 @@ func (cfg *apiConfig) handlerAllChirps(w http.ResponseWriter, r *http.Request) {
 				UserID:     dbchirp.UserID.String(),
 			})
 	}
+	// The body stays a plain array, as it always was; the next page is in
+	// the headers.
+	pagination.SetNextPage(w.Header(), r.URL, next)
 
 	err = respondWithJSON(w, 200, chirps)
 	if err != nil {
@@ -169,13 +537,7 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		Email            string `json:"email"`
 		Password         string `json:"password"`
 		ExpiresInSeconds int    `json:"expires_in_seconds"`
-	}
-	type LoginResponse struct {
-		ID         string    `json:"id"`
-		Created_at time.Time `json:"created_at"`
-		Updated_at time.Time `json:"updated_at"`
-		Email      string    `json:"email"`
-		Token      string    `json:"token"`
+		UseCookie        bool   `json:"use_cookie"`
 	}
 
 	// Parse the request
@@ -200,37 +562,180 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	//	http.Error(w, "Incorrect email or password.", http.StatusUnauthorized)
 	//	return
 	//}
+	// Refuse outright during a lockout, before looking at the password.
+	clientIP := cfg.clientIP(r)
+	wait, err := cfg.loginLockedFor(r.Context(), request.Email, clientIP)
+	if err != nil {
+		log.Printf("Error checking login lockout: %s", err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		cfg.audit(r, auditLoginFailure, uuid.Nil, map[string]any{
+			"email":  request.Email,
+			"reason": "locked_out",
+		})
+		respondLockedOut(w, wait)
+		return
+	}
 	// Get the user from the DB.
 	storedUser, err := cfg.db.GetUserByEmail(r.Context(), request.Email)
 	if err != nil {
 		log.Printf("Error fetching user from DB: %s", err.Error())
+		// Take as long as a wrong password would, so that response times
+		// don't give away which emails have accounts.
+		auth.FakePasswordCheck(request.Password)
+		cfg.recordLoginFailure(r.Context(), request.Email, clientIP)
+		cfg.audit(r, auditLoginFailure, uuid.Nil, map[string]any{
+			"email":  request.Email,
+			"reason": "unknown_email",
+		})
 		http.Error(w, "Incorrect email or password.", http.StatusUnauthorized)
 		return
 	}
 	// Check if the password hashes match, and respond with 401 if they don't.
-	err = auth.CheckPasswordHash(storedUser.HashedPassword, request.Password)
+	err = auth.CheckLoginPassword(storedUser.HashedPassword, request.Password)
 	if err != nil {
 		log.Println("Password hashes don't match in login attempt.")
+		cfg.recordLoginFailure(r.Context(), request.Email, clientIP)
+		cfg.audit(r, auditLoginFailure, storedUser.ID, map[string]any{
+			"email":  request.Email,
+			"reason": "wrong_password",
+		})
 		http.Error(w, "Incorrect email or password.", http.StatusUnauthorized)
 		return
 	}
+	// This is the only time we have the plaintext, so it's the only chance to
+	// move the user onto the current hashing algorithm and parameters.
+	if auth.NeedsRehash(storedUser.HashedPassword) {
+		cfg.rehashPassword(r.Context(), storedUser.ID, request.Password)
+	}
+
+	// With 2FA on, the password only gets you as far as the second step.
+	// Failures aren't cleared until that's done, too, or each right password
+	// would buy another round of code guesses.
+	twoFactor, err := cfg.hasTwoFactor(r.Context(), storedUser.ID)
+	if err != nil {
+		log.Printf("Error checking for 2FA: %s", err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		cfg.respondWithChallenge(w, storedUser)
+		return
+	}
+	cfg.clearLoginFailures(r.Context(), request.Email)
+
+	cfg.respondWithLogin(w, r, storedUser,
+		time.Second*time.Duration(request.ExpiresInSeconds), request.UseCookie)
+}
+
+// respondWithChallenge sends a user who's got past the first step of logging
+// in the token for the second.
+func (cfg *apiConfig) respondWithChallenge(w http.ResponseWriter,
+	user database.User) {
+	type ChallengeResponse struct {
+		MFARequired    bool   `json:"mfa_required"`
+		ChallengeToken string `json:"challenge_token"`
+	}
+
+	challenge, err := cfg.keyring.Sign(
+		auth.NewChallengeClaims(user.ID, auth.AudienceLoginChallenge),
+		loginChallengeExpiry)
+	if err != nil {
+		log.Println("Couldn't generate challenge token: " + err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	err = respondWithJSON(w, http.StatusOK, ChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: challenge,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+// respondWithLogin issues a fresh access and refresh token for a user who's
+// just proven who they are, and sends them with the user's details. With
+// useCookie, it starts a cookie session instead, and sends its CSRF token.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request,
+	user database.User, expiresIn time.Duration, useCookie bool) {
+	type LoginResponse struct {
+		ID           string    `json:"id"`
+		Created_at   time.Time `json:"created_at"`
+		Updated_at   time.Time `json:"updated_at"`
+		Email        string    `json:"email"`
+		Token        string    `json:"token,omitempty"`
+		RefreshToken string    `json:"refresh_token,omitempty"`
+		CSRFToken    string    `json:"csrf_token,omitempty"`
+	}
+
+	if useCookie {
+		csrfToken, err := cfg.startCookieSession(w, r, user)
+		if err != nil {
+			log.Println("Couldn't start cookie session: " + err.Error())
+			http.Error(w, "Auth failed but because of us, not you.",
+				http.StatusInternalServerError)
+			return
+		}
+		cfg.audit(r, auditLoginSuccess, user.ID, map[string]any{
+			"cookie": true,
+		})
+		err = respondWithJSON(w, http.StatusOK, LoginResponse{
+			ID:         user.ID.String(),
+			Created_at: user.CreatedAt,
+			Updated_at: user.UpdatedAt,
+			Email:      user.Email,
+			CSRFToken:  csrfToken,
+		})
+		if err != nil {
+			errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+			log.Println(errorStr)
+		}
+		return
+	}
 
-	jwt, err := auth.MakeJWT(storedUser.ID, cfg.secret,
-		time.Second*time.Duration(request.ExpiresInSeconds))
+	session, err := cfg.startSession(r, user.ID)
 	if err != nil {
-		log.Println("Couldn't generate JWT") // This should have more info.
+		log.Println("Couldn't start session: " + err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	jwt, err := cfg.keyring.Sign(
+		auth.NewClaims(user.ID, user.Role, auth.WithSession(session.ID)),
+		expiresIn)
+	if err != nil {
+		log.Println("Couldn't generate JWT: " + err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := cfg.issueRefreshToken(r.Context(), user.ID,
+		session.ID)
+	if err != nil {
+		log.Println("Couldn't issue refresh token: " + err.Error())
 		http.Error(w, "Auth failed but because of us, not you.",
 			http.StatusInternalServerError)
 		return
 	}
 
 	response := LoginResponse{
-		ID:         storedUser.ID.String(),
-		Created_at: storedUser.CreatedAt,
-		Updated_at: storedUser.UpdatedAt,
-		Email:      storedUser.Email,
-		Token:      jwt,
+		ID:           user.ID.String(),
+		Created_at:   user.CreatedAt,
+		Updated_at:   user.UpdatedAt,
+		Email:        user.Email,
+		Token:        jwt,
+		RefreshToken: refreshToken,
 	}
+	cfg.audit(r, auditLoginSuccess, user.ID, map[string]any{
+		"session_id": session.ID,
+	})
 	err = respondWithJSON(w, http.StatusOK, response)
 	if err != nil {
 		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
@@ -242,6 +747,9 @@ func (cfg *apiConfig) handlerUseradd(w http.ResponseWriter, r *http.Request) {
 	type CUReq struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// The proof of work, if it's required.
+		PoWChallenge string `json:"pow_challenge"`
+		PoWSolution  string `json:"pow_solution"`
 	}
 	type Response struct {
 		ID         string    `json:"id"`
@@ -259,7 +767,31 @@ func (cfg *apiConfig) handlerUseradd(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, errorStr, 500)
 		return
 	}
-	// Then, try to get a password hash.
+	if !validEmail(request.Email) {
+		http.Error(w, "Not a valid email address.", 400)
+		return
+	}
+	// Then, make sure the password's acceptable, and try to get a hash.
+	if !checkNewPassword(w, request.Password, request.Email) {
+		return
+	}
+	// Only once everything else is in order, so a typo doesn't waste the
+	// work.
+	if cfg.signupPoW.Difficulty > 0 {
+		err = cfg.checkSignupPoW(r, request.PoWChallenge, request.PoWSolution)
+		if errors.Is(err, errBadPoW) {
+			http.Error(w, "Proof of work required: "+err.Error(),
+				http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			errorStr := fmt.Sprintf("Error checking proof of work: %s",
+				err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 500)
+			return
+		}
+	}
 	hashedPassword, err := auth.HashPassword(request.Password)
 	if err != nil {
 		errorStr := fmt.Sprintf("Error creating user: %s", err.Error())
@@ -279,6 +811,13 @@ func (cfg *apiConfig) handlerUseradd(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, errorStr, 500)
 		return
 	}
+	cfg.audit(r, auditUserCreate, createdUser.ID, nil)
+	// The account exists either way; if this fails, they can ask for
+	// another.
+	err = cfg.sendVerificationEmail(r.Context(), createdUser)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err.Error())
+	}
 	response := Response{
 		ID:         createdUser.ID.String(),
 		Created_at: createdUser.CreatedAt,
@@ -294,11 +833,8 @@ func (cfg *apiConfig) handlerUseradd(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlerReset empties the database. It's only routed on the dev platform.
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
-	if cfg.platform != "dev" {
-		w.WriteHeader(403)
-		return
-	}
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	err := cfg.db.Reset(r.Context())
 	if err != nil {
@@ -307,6 +843,7 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cfg.fileserverHits.Store(0)
+	cfg.audit(r, auditAdminReset, uuid.Nil, nil)
 	w.WriteHeader(200)
 	_, err = w.Write([]byte("OK"))
 	if err != nil {
@@ -349,17 +886,8 @@ func (cfg *apiConfig) handlerChirpadd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Println("Error getting bearer token: " + err.Error())
-		http.Error(w, "Authentication error: "+err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		log.Println("Error validating JWT: " + err.Error())
-		http.Error(w, "Authentication error: "+err.Error(), http.StatusUnauthorized)
+	userID := authFromContext(r.Context()).UserID
+	if !cfg.checkVerified(w, r, userID) {
 		return
 	}
 
@@ -455,6 +983,36 @@ func respondWithJSON(w http.ResponseWriter, code int, payload any) error {
 	return nil
 }
 
+// sendMailAsync sends msg in the background, logging any failure. That way
+// how long sending takes can't tell the caller anything, such as whether the
+// address belongs to anyone.
+func (cfg *apiConfig) sendMailAsync(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Error sending %q mail: %s", msg.Subject, err.Error())
+		}
+	}()
+}
+
+// inTx runs fn in a transaction, which is committed if fn succeeds and
+// rolled back otherwise.
+func (cfg *apiConfig) inTx(ctx context.Context,
+	fn func(*database.Queries) error) error {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't start transaction: %w", err)
+	}
+	err = fn(cfg.db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func splitWithSpaces(s string) []string {
 	var beg int
 	res := make([]string, 0)
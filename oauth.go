@@ -0,0 +1,700 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chirpy is an OAuth 2.0 authorization server (RFC 6749) for third-party
+// apps, supporting only the authorization code grant, and only with PKCE.
+const authorizationCodeExpiry = 10 * time.Minute
+
+var (
+	errBadCredentials = errors.New("wrong email, password or code")
+	errInvalidClient  = errors.New("unknown client or bad client secret")
+	errClientRevoked  = errors.New("app's access has been revoked")
+)
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsWrite: "Post chirps as you, and edit or delete yours",
+}
+
+// validRedirectURI reports whether a client may register uri: it has to be
+// HTTPS, a loopback address, or a private-use scheme for a native app (RFC
+// 8252), and can't have a fragment.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return strings.Contains(u.Scheme, ".")
+}
+
+// authorizeRequest is a checked request to /oauth/authorize.
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// checkAuthorizeRequest checks the parameters of an authorization request.
+// If they're bad, it answers the request itself and returns false: straight
+// to the user if the client or redirect URI can't be trusted, and otherwise
+// by sending the error back to the client.
+func (cfg *apiConfig) checkAuthorizeRequest(w http.ResponseWriter,
+	r *http.Request, params url.Values) (authorizeRequest, bool) {
+	var ar authorizeRequest
+	clientID, err := uuid.Parse(params.Get("client_id"))
+	if err != nil {
+		http.Error(w, "Unknown client.", 400)
+		return ar, false
+	}
+	ar.Client, err = cfg.db.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Unknown client.", 400)
+		return ar, false
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching client: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return ar, false
+	}
+	ar.RedirectURI = params.Get("redirect_uri")
+	if !slices.Contains(ar.Client.RedirectUris, ar.RedirectURI) {
+		http.Error(w, "Redirect URI isn't registered for this client.", 400)
+		return ar, false
+	}
+	ar.State = params.Get("state")
+
+	if params.Get("response_type") != "code" {
+		redirectWithError(w, r, ar, "unsupported_response_type",
+			"only the code response type is supported")
+		return ar, false
+	}
+	ar.CodeChallenge = params.Get("code_challenge")
+	if ar.CodeChallenge == "" ||
+		params.Get("code_challenge_method") != auth.PKCEMethodS256 {
+		redirectWithError(w, r, ar, "invalid_request",
+			"PKCE with the S256 method is required")
+		return ar, false
+	}
+	for _, scope := range strings.Fields(params.Get("scope")) {
+		if !slices.Contains(auth.ClientScopes, scope) {
+			redirectWithError(w, r, ar, "invalid_scope", "unknown scope "+scope)
+			return ar, false
+		}
+		if !slices.Contains(ar.Scopes, scope) {
+			ar.Scopes = append(ar.Scopes, scope)
+		}
+	}
+	if len(ar.Scopes) == 0 {
+		ar.Scopes = slices.Clone(auth.ClientScopes)
+	}
+	return ar, true
+}
+
+// redirectWithParams sends the user back to the client, with params added to
+// its redirect URI.
+func redirectWithParams(w http.ResponseWriter, r *http.Request,
+	ar authorizeRequest, params url.Values) {
+	u, _ := url.Parse(ar.RedirectURI)
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	if ar.State != "" {
+		query.Set("state", ar.State)
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request,
+	ar authorizeRequest, code, description string) {
+	redirectWithParams(w, r, ar, url.Values{
+		"error":             {code},
+		"error_description": {description},
+	})
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<html>
+  <head><title>Authorize {{.Client.Name}}</title></head>
+  <body>
+    <h1>{{.Client.Name}} wants to use your Chirpy account</h1>
+    <p>If you allow it, it will be able to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.}}</li>{{end}}
+    </ul>
+    <p>It will never see your password.</p>
+    {{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+    <form method="POST" action="/oauth/authorize">
+      <input type="hidden" name="response_type" value="code">
+      <input type="hidden" name="client_id" value="{{.Client.ID}}">
+      <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+      <input type="hidden" name="scope" value="{{.Scope}}">
+      <input type="hidden" name="state" value="{{.State}}">
+      <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+      <input type="hidden" name="code_challenge_method" value="S256">
+      <p><label>Email <input type="email" name="email" value="{{.Email}}"></label></p>
+      <p><label>Password <input type="password" name="password"></label></p>
+      <p><label>2FA code, if you use it <input type="text" name="code" autocomplete="one-time-code"></label></p>
+      <button type="submit" name="decision" value="approve">Allow</button>
+      <button type="submit" name="decision" value="deny">Deny</button>
+    </form>
+  </body>
+</html>`))
+
+// renderConsent shows the user the consent page for ar.
+func renderConsent(w http.ResponseWriter, code int, ar authorizeRequest,
+	email, errorMsg string) {
+	var descriptions []string
+	for _, scope := range ar.Scopes {
+		descriptions = append(descriptions, scopeDescriptions[scope])
+	}
+	// Another site mustn't be able to frame this page, and trick users into
+	// clicking "Allow".
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	err := consentTemplate.Execute(w, struct {
+		authorizeRequest
+		Scopes []string
+		Scope  string
+		Email  string
+		Error  string
+	}{ar, descriptions, strings.Join(ar.Scopes, " "), email, errorMsg})
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err.Error())
+	}
+}
+
+// consentUser checks the credentials typed into the consent page, the same
+// way, and with the same throttling, as logging in does. A wrong email,
+// password or code gives errBadCredentials; a lockout, a nonzero wait.
+func (cfg *apiConfig) consentUser(ctx context.Context, email, password,
+	code, ip string) (database.User, time.Duration, error) {
+	wait, err := cfg.loginLockedFor(ctx, email, ip)
+	if err != nil || wait > 0 {
+		return database.User{}, wait, err
+	}
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.FakePasswordCheck(password)
+		cfg.recordLoginFailure(ctx, email, ip)
+		return user, 0, errBadCredentials
+	}
+	if err != nil {
+		return user, 0, err
+	}
+	err = auth.CheckLoginPassword(user.HashedPassword, password)
+	if errors.Is(err, auth.ErrPasswordMismatch) {
+		cfg.recordLoginFailure(ctx, email, ip)
+		return user, 0, errBadCredentials
+	}
+	if err != nil {
+		return user, 0, err
+	}
+	if auth.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(ctx, user.ID, password)
+	}
+
+	twoFactor, err := cfg.hasTwoFactor(ctx, user.ID)
+	if err != nil {
+		return user, 0, err
+	}
+	if twoFactor {
+		cred, err := cfg.db.GetTOTPCredential(ctx, user.ID)
+		if err != nil {
+			return user, 0, err
+		}
+		err = cfg.checkSecondFactor(ctx, cred, code, "")
+		if errors.Is(err, errSecondFactor) {
+			cfg.recordLoginFailure(ctx, email, ip)
+			return user, 0, errBadCredentials
+		}
+		if err != nil {
+			return user, 0, err
+		}
+	}
+	cfg.clearLoginFailures(ctx, email)
+	return user, 0, nil
+}
+
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	ar, ok := cfg.checkAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+	renderConsent(w, http.StatusOK, ar, "", "")
+}
+
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	ar, ok := cfg.checkAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+	if r.PostForm.Get("decision") != "approve" {
+		redirectWithError(w, r, ar, "access_denied", "the user said no")
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	user, wait, err := cfg.consentUser(r.Context(), email,
+		r.PostForm.Get("password"), r.PostForm.Get("code"), cfg.clientIP(r))
+	if wait > 0 {
+		renderConsent(w, http.StatusTooManyRequests, ar, email,
+			fmt.Sprintf("Too many failed logins; try again in %d seconds.",
+				int(wait.Seconds())+1))
+		return
+	}
+	if errors.Is(err, errBadCredentials) {
+		log.Println("Bad credentials on OAuth consent page.")
+		cfg.audit(r, auditLoginFailure, user.ID, map[string]any{
+			"email":     email,
+			"reason":    "bad_credentials",
+			"client_id": ar.Client.ID,
+		})
+		renderConsent(w, http.StatusUnauthorized, ar, email,
+			"Wrong email, password or 2FA code.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking credentials: %s", err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+
+	code, err := auth.MakeToken()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	scope := strings.Join(ar.Scopes, " ")
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		err := q.UpsertOAuthGrant(r.Context(), database.UpsertOAuthGrantParams{
+			UserID:   user.ID,
+			ClientID: ar.Client.ID,
+			Scope:    scope,
+		})
+		if err != nil {
+			return err
+		}
+		return q.CreateAuthorizationCode(r.Context(),
+			database.CreateAuthorizationCodeParams{
+				CodeHash:      auth.HashToken(code),
+				ClientID:      ar.Client.ID,
+				UserID:        user.ID,
+				RedirectUri:   ar.RedirectURI,
+				Scope:         scope,
+				CodeChallenge: ar.CodeChallenge,
+				ExpiresAt:     time.Now().Add(authorizationCodeExpiry),
+			})
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error authorizing client: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("User %s authorized client %s for %q", user.ID, ar.Client.ID,
+		scope)
+	cfg.audit(r, auditOAuthAuthorize, user.ID, map[string]any{
+		"client_id": ar.Client.ID,
+		"scope":     scope,
+	})
+	redirectWithParams(w, r, ar, url.Values{"code": {code}})
+}
+
+// respondOAuthError sends an error from the token endpoint, as per RFC 6749,
+// section 5.2.
+func respondOAuthError(w http.ResponseWriter, code int, oauthErr,
+	description string) {
+	type Response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	err := respondWithJSON(w, code, Response{
+		Error:            oauthErr,
+		ErrorDescription: description,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+// authenticateClient returns the OAuth client making r, which must already
+// have had its form parsed. Confidential clients can authenticate with HTTP
+// Basic, or in the form; public ones just give their ID.
+func (cfg *apiConfig) authenticateClient(r *http.Request) (database.OauthClient,
+	error) {
+	rawClientID, secret, ok := r.BasicAuth()
+	if !ok {
+		rawClientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	clientID, err := uuid.Parse(rawClientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return client, errInvalidClient
+	}
+	if err != nil {
+		return client, err
+	}
+	if client.SecretHash.Valid && subtle.ConstantTimeCompare(
+		[]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		log.Printf("Bad secret for client %s", client.ID)
+		return client, errInvalidClient
+	}
+	return client, nil
+}
+
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err := r.ParseForm()
+	if err != nil {
+		respondOAuthError(w, 400, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		respondOAuthError(w, 400, "unsupported_grant_type",
+			"only authorization_code is supported")
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if errors.Is(err, errInvalidClient) {
+		respondOAuthError(w, 401, "invalid_client", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching client: %s", err.Error())
+		respondOAuthError(w, 500, "server_error", "error fetching client")
+		return
+	}
+
+	// The code is only used up once the request has shown it's for this
+	// client, so someone who gets hold of a code but can't redeem it can't
+	// spend it, or make it look reused, either.
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+	code, err := cfg.db.GetAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondOAuthError(w, 400, "invalid_grant",
+			"invalid, expired or used code")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching authorization code: %s", err.Error())
+		respondOAuthError(w, 500, "server_error", "error fetching code")
+		return
+	}
+	if code.ClientID != client.ID ||
+		code.RedirectUri != r.PostForm.Get("redirect_uri") ||
+		!auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondOAuthError(w, 400, "invalid_grant",
+			"code doesn't match client, redirect URI or code verifier")
+		return
+	}
+
+	_, err = cfg.db.UseAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A code turning up twice means it was stolen along the way, so
+		// whatever was issued for it can't be trusted either (RFC 6749,
+		// section 4.1.2).
+		used, err := cfg.db.GetAuthorizationCode(r.Context(), codeHash)
+		if err == nil && used.UsedAt.Valid {
+			log.Printf("Authorization code reused; revoking client %s for user %s",
+				used.ClientID, used.UserID)
+			_, err = cfg.db.DeleteOAuthGrant(r.Context(),
+				database.DeleteOAuthGrantParams{
+					UserID:   used.UserID,
+					ClientID: used.ClientID,
+				})
+			if err != nil {
+				log.Printf("Error revoking grant: %s", err.Error())
+			}
+		}
+		respondOAuthError(w, 400, "invalid_grant",
+			"invalid, expired or used code")
+		return
+	}
+	if err != nil {
+		log.Printf("Error using authorization code: %s", err.Error())
+		respondOAuthError(w, 500, "server_error", "error using code")
+		return
+	}
+
+	expiresIn := time.Second * defaultExpiryInSeconds
+	token, err := cfg.keyring.MakeJWT(code.UserID, expiresIn,
+		auth.WithClient(client.ID.String(), strings.Fields(code.Scope)))
+	if err != nil {
+		log.Printf("Error making token: %s", err.Error())
+		respondOAuthError(w, 500, "server_error", "error making token")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, Response{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(expiresIn.Seconds()),
+		Scope:       code.Scope,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+// checkClientToken makes sure the user hasn't since revoked the app a token
+// was issued to.
+func (cfg *apiConfig) checkClientToken(ctx context.Context, userID uuid.UUID,
+	claims *auth.Claims) error {
+	clientID, err := uuid.Parse(claims.ClientID)
+	if err != nil {
+		return fmt.Errorf("invalid client ID: %w", err)
+	}
+	grant, err := cfg.db.GetOAuthGrant(ctx, database.GetOAuthGrantParams{
+		UserID:   userID,
+		ClientID: clientID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errClientRevoked
+	}
+	if err != nil {
+		return err
+	}
+	// A grant made after the token was issued means the app was revoked and
+	// authorized again since; tokens from before the revoke stay revoked.
+	// iat is in whole seconds, so the grant's time is rounded down to match.
+	if claims.IssuedAt == nil ||
+		claims.IssuedAt.Time.Before(grant.CreatedAt.Truncate(time.Second)) {
+		return errClientRevoked
+	}
+	// Authorizing the app again with fewer scopes takes the rest away from
+	// tokens it already has, too.
+	granted := strings.Fields(grant.Scope)
+	for _, scope := range claims.Scopes() {
+		if !slices.Contains(granted, scope) {
+			return errClientRevoked
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerOAuthClientCreate(w http.ResponseWriter, r *http.Request) {
+	type OCReq struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	type Response struct {
+		ClientID     string    `json:"client_id"`
+		ClientSecret string    `json:"client_secret,omitempty"`
+		Created_at   time.Time `json:"created_at"`
+		Name         string    `json:"name"`
+		RedirectURIs []string  `json:"redirect_uris"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "register apps") {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	request := OCReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if strings.TrimSpace(request.Name) == "" {
+		http.Error(w, "Clients need a name.", 400)
+		return
+	}
+	if len(request.RedirectURIs) == 0 {
+		http.Error(w, "Clients need at least one redirect URI.", 400)
+		return
+	}
+	for _, uri := range request.RedirectURIs {
+		if !validRedirectURI(uri) {
+			http.Error(w, "Invalid redirect URI: "+uri, 400)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if request.Confidential {
+		secret, err = auth.MakeToken()
+		if err != nil {
+			log.Println(err.Error())
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+	client, err := cfg.db.CreateOAuthClient(r.Context(),
+		database.CreateOAuthClientParams{
+			OwnerID:      userID,
+			Name:         request.Name,
+			RedirectUris: request.RedirectURIs,
+			SecretHash:   secretHash,
+		})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error creating client: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("User %s registered OAuth client %s", userID, client.ID)
+	cfg.audit(r, auditOAuthClientCreate, userID, map[string]any{
+		"client_id": client.ID,
+	})
+
+	// This is the only time the secret is ever shown.
+	err = respondWithJSON(w, http.StatusCreated, Response{
+		ClientID:     client.ID.String(),
+		ClientSecret: secret,
+		Created_at:   client.CreatedAt,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerListAuthorizations(w http.ResponseWriter, r *http.Request) {
+	type Authorization struct {
+		ClientID   string    `json:"client_id"`
+		Name       string    `json:"name"`
+		Scope      string    `json:"scope"`
+		Created_at time.Time `json:"created_at"`
+		Updated_at time.Time `json:"updated_at"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	grants, err := cfg.db.ListOAuthGrants(r.Context(), userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching authorizations: %s",
+			err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	authorizations := []Authorization{}
+	for _, grant := range grants {
+		authorizations = append(authorizations,
+			Authorization{
+				ClientID:   grant.ClientID.String(),
+				Name:       grant.Name,
+				Scope:      grant.Scope,
+				Created_at: grant.CreatedAt,
+				Updated_at: grant.UpdatedAt,
+			})
+	}
+
+	err = respondWithJSON(w, 200, authorizations)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerRevokeAuthorization(w http.ResponseWriter, r *http.Request) {
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "revoke apps") {
+		return
+	}
+	reqID := r.PathValue("client_id")
+	clientID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid client ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	var revoked int64
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		revoked, err = q.DeleteOAuthGrant(r.Context(),
+			database.DeleteOAuthGrantParams{UserID: userID, ClientID: clientID})
+		if err != nil {
+			return err
+		}
+		return q.DeleteAuthorizationCodes(r.Context(),
+			database.DeleteAuthorizationCodesParams{
+				UserID:   userID,
+				ClientID: clientID,
+			})
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error revoking authorization: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "No such authorization.", http.StatusNotFound)
+		return
+	}
+	log.Printf("User %s revoked OAuth client %s", userID, clientID)
+	cfg.audit(r, auditOAuthRevoke, userID, map[string]any{
+		"client_id": clientID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
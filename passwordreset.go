@@ -0,0 +1,195 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	passwordResetExpiry = time.Hour
+	// Resets are limited like verification emails, so the endpoint can't be
+	// used to flood someone's inbox.
+	passwordResetInterval   = time.Minute
+	passwordResetDailyLimit = 5
+)
+
+// passwordResetAllowed reports whether userID can be sent another reset
+// token yet.
+func (cfg *apiConfig) passwordResetAllowed(r *http.Request,
+	userID uuid.UUID) (bool, error) {
+	recent, err := cfg.db.CountPasswordResetTokensSince(r.Context(),
+		database.CountPasswordResetTokensSinceParams{
+			UserID:    userID,
+			CreatedAt: time.Now().Add(-passwordResetInterval),
+		})
+	if err != nil || recent > 0 {
+		return false, err
+	}
+	today, err := cfg.db.CountPasswordResetTokensSince(r.Context(),
+		database.CountPasswordResetTokensSinceParams{
+			UserID:    userID,
+			CreatedAt: time.Now().Add(-24 * time.Hour),
+		})
+	return today < passwordResetDailyLimit, err
+}
+
+func (cfg *apiConfig) handlerPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type PRReq struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := PRReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	// The answer's the same whether or not there's such a user, or a token
+	// was actually sent, so this can't be used to find out who has an
+	// account.
+	user, err := cfg.db.GetUserByEmail(r.Context(), request.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("Password reset requested for unknown email.")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	allowed, err := cfg.passwordResetAllowed(r, user.ID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error checking password resets: %s",
+			err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if !allowed {
+		log.Printf("Too many password resets for user %s; not sending another",
+			user.ID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	err = cfg.db.CreatePasswordResetToken(r.Context(),
+		database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(passwordResetExpiry),
+		})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error creating reset token: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	cfg.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Someone (hopefully you) asked to reset your Chirpy password.\n" +
+			"To choose a new one, use this token within the next hour:\n\n" +
+			"    " + token + "\n\n" +
+			"If it wasn't you, you can ignore this email.\n",
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type PRCReq struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := PRCReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	// Whoever reset the password is the only one who should still be able
+	// to get in, so every other outstanding reset token and session goes.
+	// A password the policy won't take leaves the token unused, to try
+	// again with.
+	var user database.User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		resetToken, err := q.UsePasswordResetToken(r.Context(),
+			auth.HashToken(request.Token))
+		if err != nil {
+			return err
+		}
+		user, err = q.GetUserByID(r.Context(), resetToken.UserID)
+		if err != nil {
+			return err
+		}
+		err = auth.CheckPasswordPolicy(request.Password, user.Email)
+		if err != nil {
+			return err
+		}
+		hashedPassword, err := auth.HashPassword(request.Password)
+		if err != nil {
+			return err
+		}
+		user, err = q.UpdateUser(r.Context(), database.UpdateUserParams{
+			ID:             user.ID,
+			Email:          user.Email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+		err = q.InvalidatePasswordResetTokens(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		err = q.RevokeUserRefreshTokens(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		return q.RevokeUserSessions(r.Context(), user.ID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Invalid or expired reset token.", 400)
+		return
+	}
+	if respondPolicyError(w, err) {
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error resetting password: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	cfg.clearLoginFailures(r.Context(), user.Email)
+	log.Printf("Password reset for user %s", user.ID)
+	cfg.audit(r, auditPasswordReset, user.ID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
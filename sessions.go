@@ -0,0 +1,221 @@
+package main
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Every login starts a session, which its access tokens (through their sid
+// claim) and refresh token family (whose ID is the session's) belong to.
+// Revoking the session stops both working.
+const (
+	// How stale last_seen_at can get before a request updates it; updating
+	// on every single request would be a write per request.
+	sessionTouchInterval = time.Minute
+	maxUserAgentLength   = 512
+)
+
+var (
+	errNoSession      = errors.New("no such session")
+	errSessionRevoked = errors.New("session has been revoked")
+)
+
+// startSession records a new login by userID, from the device making r.
+func (cfg *apiConfig) startSession(r *http.Request,
+	userID uuid.UUID) (database.Session, error) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	session, err := cfg.db.CreateSession(r.Context(),
+		database.CreateSessionParams{
+			UserID:    userID,
+			UserAgent: userAgent,
+			Ip:        cfg.clientIP(r),
+		})
+	if err != nil {
+		return session, fmt.Errorf("error creating session: %w", err)
+	}
+	return session, nil
+}
+
+// liveSession returns one of userID's sessions, as long as it hasn't been
+// revoked. Otherwise, it gives errNoSession or errSessionRevoked.
+func (cfg *apiConfig) liveSession(ctx context.Context, sessionID,
+	userID uuid.UUID) (database.Session, error) {
+	session, err := cfg.db.GetSession(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, errNoSession
+	}
+	if err != nil {
+		return session, err
+	}
+	if session.UserID != userID {
+		return session, errNoSession
+	}
+	if session.RevokedAt.Valid {
+		return session, errSessionRevoked
+	}
+	return session, nil
+}
+
+// checkSession makes sure a token's session is still live, and notes that
+// it's been seen.
+func (cfg *apiConfig) checkSession(r *http.Request, sessionID,
+	userID uuid.UUID) error {
+	session, err := cfg.liveSession(r.Context(), sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		err = cfg.db.TouchSession(r.Context(), database.TouchSessionParams{
+			ID: session.ID,
+			Ip: cfg.clientIP(r),
+		})
+		if err != nil {
+			log.Printf("Error updating session: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// revokeSession ends one of userID's sessions, along with its refresh tokens.
+// It returns how many sessions it ended: zero if there was no such live
+// session.
+func (cfg *apiConfig) revokeSession(ctx context.Context, sessionID,
+	userID uuid.UUID) (int64, error) {
+	var revoked int64
+	err := cfg.inTx(ctx, func(q *database.Queries) error {
+		var err error
+		revoked, err = q.RevokeSession(ctx, database.RevokeSessionParams{
+			ID:     sessionID,
+			UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+		return q.RevokeRefreshTokenFamily(ctx, sessionID)
+	})
+	return revoked, err
+}
+
+func (cfg *apiConfig) handlerListSessions(w http.ResponseWriter, r *http.Request) {
+	type Session struct {
+		ID           string    `json:"id"`
+		Created_at   time.Time `json:"created_at"`
+		Last_seen_at time.Time `json:"last_seen_at"`
+		UserAgent    string    `json:"user_agent"`
+		IP           string    `json:"ip"`
+		Current      bool      `json:"current"`
+	}
+
+	ra := authFromContext(r.Context())
+	// Past the refresh token lifetime, a session can't be used any more
+	// whether or not it was revoked.
+	dbSessions, err := cfg.db.ListActiveSessions(r.Context(),
+		database.ListActiveSessionsParams{
+			UserID:     ra.UserID,
+			LastSeenAt: time.Now().Add(-refreshTokenExpiry),
+		})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching sessions: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	sessions := []Session{}
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions,
+			Session{
+				ID:           dbSession.ID.String(),
+				Created_at:   dbSession.CreatedAt,
+				Last_seen_at: dbSession.LastSeenAt,
+				UserAgent:    dbSession.UserAgent,
+				IP:           dbSession.Ip,
+				Current:      dbSession.ID == ra.SessionID,
+			})
+	}
+
+	err = respondWithJSON(w, 200, sessions)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "revoke sessions") {
+		return
+	}
+	reqID := r.PathValue("id")
+	sessionID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid session ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	revoked, err := cfg.revokeSession(r.Context(), sessionID, userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error revoking session: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "No such session.", http.StatusNotFound)
+		return
+	}
+	log.Printf("User %s revoked session %s", userID, sessionID)
+	cfg.audit(r, auditSessionRevoke, userID, map[string]any{
+		"session_id": sessionID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ra := authFromContext(r.Context())
+	if refuseImpersonation(w, r, "revoke sessions") {
+		return
+	}
+	// A token with no session (uuid.Nil) keeps nothing alive, so this logs
+	// out everywhere.
+	err := cfg.inTx(r.Context(), func(q *database.Queries) error {
+		_, err := q.RevokeOtherSessions(r.Context(),
+			database.RevokeOtherSessionsParams{
+				UserID: ra.UserID,
+				ID:     ra.SessionID,
+			})
+		if err != nil {
+			return err
+		}
+		return q.RevokeOtherRefreshTokens(r.Context(),
+			database.RevokeOtherRefreshTokensParams{
+				UserID:   ra.UserID,
+				FamilyID: ra.SessionID,
+			})
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error revoking sessions: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("User %s revoked all sessions but %s", ra.UserID, ra.SessionID)
+	cfg.audit(r, auditSessionRevokeOthers, ra.UserID, map[string]any{
+		"kept_session_id": ra.SessionID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
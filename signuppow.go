@@ -0,0 +1,146 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Signups can be made to cost some work, hashcash-style, so that accounts
+// can't be scripted in bulk for free. A client gets a signed challenge from
+// GET /api/users/challenge, solves it, and sends both with the signup. The
+// difficulty goes up with the signup rate, and each challenge only works
+// once.
+const (
+	powChallengeExpiry = 10 * time.Minute
+	// Signups over this window count towards the rate.
+	powRateWindow = 10 * time.Minute
+	// defaultPoWTarget is how many signups a window can have before
+	// challenges start getting harder.
+	defaultPoWTarget = 20
+)
+
+var errBadPoW = errors.New("missing, invalid or used proof of work")
+
+// signupPoW is how signups' proof of work is set up. A zero Difficulty
+// turns it off.
+type signupPoW struct {
+	Difficulty int
+	Target     int
+}
+
+// signupPoWFromEnv reads CHIRPY_SIGNUP_POW_DIFFICULTY and
+// CHIRPY_SIGNUP_POW_TARGET.
+func signupPoWFromEnv() (signupPoW, error) {
+	pow := signupPoW{Target: defaultPoWTarget}
+	for _, setting := range []struct {
+		env   string
+		value *int
+	}{
+		{"CHIRPY_SIGNUP_POW_DIFFICULTY", &pow.Difficulty},
+		{"CHIRPY_SIGNUP_POW_TARGET", &pow.Target},
+	} {
+		raw := os.Getenv(setting.env)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return pow, fmt.Errorf("invalid %s: %w", setting.env, err)
+		}
+		*setting.value = n
+	}
+	if pow.Difficulty < 0 || pow.Difficulty > auth.MaxPoWDifficulty {
+		return pow, fmt.Errorf("signup proof-of-work difficulty must be from 0 to %d",
+			auth.MaxPoWDifficulty)
+	}
+	if pow.Target < 1 {
+		return pow, errors.New("signup proof-of-work target must be at least 1")
+	}
+	return pow, nil
+}
+
+// checkSignupPoW checks, and uses up, the proof of work sent with a signup.
+// It gives errBadPoW if it isn't good enough.
+func (cfg *apiConfig) checkSignupPoW(r *http.Request, challenge,
+	solution string) error {
+	claims, err := cfg.keyring.ParseFor(challenge, auth.AudienceSignupChallenge)
+	if err != nil {
+		return errBadPoW
+	}
+	if !auth.VerifyPoW(challenge, solution, claims.Difficulty) {
+		return errBadPoW
+	}
+	err = cfg.db.DeleteExpiredPoWChallenges(r.Context())
+	if err != nil {
+		log.Printf("Error clearing out used challenges: %s", err.Error())
+	}
+	used, err := cfg.db.UsePoWChallenge(r.Context(),
+		database.UsePoWChallengeParams{
+			ID:        claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return errBadPoW
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerSignupChallenge(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		Required   bool       `json:"required"`
+		Challenge  string     `json:"challenge,omitempty"`
+		Difficulty int        `json:"difficulty,omitempty"`
+		Expires_at *time.Time `json:"expires_at,omitempty"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if cfg.signupPoW.Difficulty == 0 {
+		err := respondWithJSON(w, http.StatusOK, Response{Required: false})
+		if err != nil {
+			errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+			log.Println(errorStr)
+		}
+		return
+	}
+
+	recent, err := cfg.db.CountUsersCreatedSince(r.Context(),
+		time.Now().Add(-powRateWindow))
+	if err != nil {
+		errorStr := fmt.Sprintf("Error counting signups: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	difficulty := auth.PoWDifficulty(cfg.signupPoW.Difficulty, int(recent),
+		cfg.signupPoW.Target)
+	challenge, err := cfg.keyring.Sign(auth.NewPoWClaims(difficulty),
+		powChallengeExpiry)
+	if err != nil {
+		log.Println("Couldn't generate challenge: " + err.Error())
+		http.Error(w, "Couldn't generate challenge.",
+			http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(powChallengeExpiry)
+	err = respondWithJSON(w, http.StatusOK, Response{
+		Required:   true,
+		Challenge:  challenge,
+		Difficulty: difficulty,
+		Expires_at: &expiresAt,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
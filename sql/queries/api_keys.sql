@@ -0,0 +1,26 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, name, prefix, key_hash, scope,
+	expires_at)
+VALUES (
+	gen_random_uuid(),
+	CURRENT_TIMESTAMP,
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+)
+RETURNING *;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT * FROM api_keys WHERE prefix = $1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys WHERE id = $1 AND user_id = $2;
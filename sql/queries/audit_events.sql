@@ -0,0 +1,16 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (created_at, event, actor_id, ip, user_agent, details)
+VALUES (CURRENT_TIMESTAMP, $1, $2, $3, $4, $5);
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg('event')::text IS NULL OR event = sqlc.narg('event'))
+	AND (sqlc.narg('actor_id')::uuid IS NULL OR actor_id = sqlc.narg('actor_id'))
+	AND (sqlc.narg('ip')::text IS NULL OR ip = sqlc.narg('ip'))
+	AND (sqlc.narg('since')::timestamptz IS NULL
+		OR created_at >= sqlc.narg('since'))
+	AND (sqlc.narg('until')::timestamptz IS NULL
+		OR created_at < sqlc.narg('until'))
+	AND (sqlc.narg('before_id')::bigint IS NULL OR id < sqlc.narg('before_id'))
+ORDER BY id DESC
+LIMIT sqlc.arg('max_results');
@@ -9,10 +9,103 @@ VALUES (
 )
 RETURNING *;
 
--- name: GetAllChirps :many
+-- name: ListChirps :many
+-- Filters left NULL don't apply. There are separate queries for each order,
+-- and for one author's chirps or everyone's, rather than one with those as
+-- parameters, so each has a plan that uses its index (chirps_created_at_idx
+-- or chirps_user_id_created_at_idx). A page starts just after the
+-- (created_at, id) of the last chirp on the one before.
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE (sqlc.narg('since')::timestamptz IS NULL
+		OR created_at >= sqlc.narg('since'))
+	AND (sqlc.narg('until')::timestamptz IS NULL
+		OR created_at < sqlc.narg('until'))
+	AND (sqlc.narg('after_created_at')::timestamptz IS NULL
+		OR (created_at, id) > (sqlc.narg('after_created_at'),
+			sqlc.narg('after_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('max_results');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('since')::timestamptz IS NULL
+		OR created_at >= sqlc.narg('since'))
+	AND (sqlc.narg('until')::timestamptz IS NULL
+		OR created_at < sqlc.narg('until'))
+	AND (sqlc.narg('after_created_at')::timestamptz IS NULL
+		OR (created_at, id) < (sqlc.narg('after_created_at'),
+			sqlc.narg('after_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('max_results');
+
+-- name: ListChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg('author_id')
+	AND (sqlc.narg('since')::timestamptz IS NULL
+		OR created_at >= sqlc.narg('since'))
+	AND (sqlc.narg('until')::timestamptz IS NULL
+		OR created_at < sqlc.narg('until'))
+	AND (sqlc.narg('after_created_at')::timestamptz IS NULL
+		OR (created_at, id) > (sqlc.narg('after_created_at'),
+			sqlc.narg('after_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('max_results');
+
+-- name: ListChirpsByAuthorDesc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg('author_id')
+	AND (sqlc.narg('since')::timestamptz IS NULL
+		OR created_at >= sqlc.narg('since'))
+	AND (sqlc.narg('until')::timestamptz IS NULL
+		OR created_at < sqlc.narg('until'))
+	AND (sqlc.narg('after_created_at')::timestamptz IS NULL
+		OR (created_at, id) < (sqlc.narg('after_created_at'),
+			sqlc.narg('after_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('max_results');
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
 WHERE id = $1;
+
+-- name: DeleteChirp :execrows
+DELETE FROM chirps
+WHERE id = $1;
+
+-- name: GetChirpByIDForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (chirp_id, created_at, replaced_at, body)
+VALUES ($1, $2, CURRENT_TIMESTAMP, $3);
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY id ASC;
+
+-- name: SearchChirps :many
+-- query is for to_tsquery. The best matches come first, then the newest; a
+-- page starts just after the (rank, created_at, id) of the last chirp on the
+-- one before. Matches in the snippet are between chr(2) and chr(3), to be
+-- swapped for markup once the rest has been escaped.
+SELECT id, created_at, updated_at, body, user_id,
+	ts_rank(search, to_tsquery('english', sqlc.arg('query'))) AS rank,
+	ts_headline('english', body, to_tsquery('english', sqlc.arg('query')),
+		'StartSel=' || chr(2) || ', StopSel=' || chr(3)) AS snippet
+FROM chirps
+WHERE search @@ to_tsquery('english', sqlc.arg('query'))
+	AND (sqlc.narg('after_rank')::real IS NULL
+		OR (ts_rank(search, to_tsquery('english', sqlc.arg('query'))),
+			created_at, id)
+		< (sqlc.narg('after_rank'), sqlc.narg('after_created_at')::timestamptz,
+			sqlc.narg('after_id')::uuid))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('max_results');
@@ -0,0 +1,14 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, created_at, user_id, email,
+	expires_at)
+VALUES ($1, CURRENT_TIMESTAMP, $2, $3, $4);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL
+	AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: CountEmailVerificationTokensSince :one
+SELECT COUNT(*) FROM email_verification_tokens
+WHERE user_id = $1 AND created_at > $2;
@@ -0,0 +1,28 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE kind = $1 AND subject = $2;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (kind, subject, failures, last_failure_at)
+VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+ON CONFLICT (kind, subject) DO UPDATE
+SET failures = CASE
+		WHEN login_throttles.last_failure_at < sqlc.arg(forget_before)::timestamptz
+		THEN 1
+		ELSE login_throttles.failures + 1
+	END,
+	last_failure_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles SET locked_until = $3
+WHERE kind = $1 AND subject = $2;
+
+-- name: ClearLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE kind = $1 AND subject = $2;
+
+-- name: ListLoginLockouts :many
+SELECT * FROM login_throttles
+WHERE locked_until > CURRENT_TIMESTAMP
+ORDER BY locked_until DESC;
@@ -0,0 +1,14 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, created_at, user_id, device_hash,
+	expires_at)
+VALUES ($1, CURRENT_TIMESTAMP, $2, $3, $4);
+
+-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND device_hash = $2 AND used_at IS NULL
+	AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: CountMagicLinkTokensSince :one
+SELECT COUNT(*) FROM magic_link_tokens
+WHERE user_id = $1 AND created_at > $2;
@@ -0,0 +1,52 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, owner_id, name,
+	redirect_uris, secret_hash)
+VALUES (
+	gen_random_uuid(),
+	CURRENT_TIMESTAMP,
+	CURRENT_TIMESTAMP,
+	$1,
+	$2,
+	$3,
+	$4
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, client_id,
+	user_id, redirect_uri, scope, code_challenge, expires_at)
+VALUES ($1, CURRENT_TIMESTAMP, $2, $3, $4, $5, $6, $7);
+
+-- name: UseAuthorizationCode :one
+UPDATE oauth_authorization_codes SET used_at = CURRENT_TIMESTAMP
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: GetAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes WHERE code_hash = $1;
+
+-- name: DeleteAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes WHERE user_id = $1 AND client_id = $2;
+
+-- name: UpsertOAuthGrant :exec
+INSERT INTO oauth_grants (user_id, client_id, created_at, updated_at, scope)
+VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $3)
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scope = EXCLUDED.scope, updated_at = CURRENT_TIMESTAMP;
+
+-- name: GetOAuthGrant :one
+SELECT * FROM oauth_grants WHERE user_id = $1 AND client_id = $2;
+
+-- name: ListOAuthGrants :many
+SELECT oauth_grants.client_id, oauth_clients.name, oauth_grants.scope,
+	oauth_grants.created_at, oauth_grants.updated_at
+FROM oauth_grants
+JOIN oauth_clients ON oauth_clients.id = oauth_grants.client_id
+WHERE oauth_grants.user_id = $1
+ORDER BY oauth_grants.created_at;
+
+-- name: DeleteOAuthGrant :execrows
+DELETE FROM oauth_grants WHERE user_id = $1 AND client_id = $2;
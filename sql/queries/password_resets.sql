@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, created_at, user_id, expires_at)
+VALUES ($1, CURRENT_TIMESTAMP, $2, $3);
+
+-- name: CountPasswordResetTokensSince :one
+SELECT COUNT(*) FROM password_reset_tokens
+WHERE user_id = $1 AND created_at > $2;
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL
+	AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND used_at IS NULL;
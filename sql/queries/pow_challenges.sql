@@ -0,0 +1,7 @@
+-- name: UsePoWChallenge :execrows
+INSERT INTO used_pow_challenges (id, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteExpiredPoWChallenges :exec
+DELETE FROM used_pow_challenges WHERE expires_at < CURRENT_TIMESTAMP;
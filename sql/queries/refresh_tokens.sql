@@ -0,0 +1,43 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id,
+	family_id, expires_at)
+VALUES (
+	$1,
+	CURRENT_TIMESTAMP,
+	CURRENT_TIMESTAMP,
+	$2,
+	$3,
+	$4
+)
+RETURNING *;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP, rotated_at = CURRENT_TIMESTAMP,
+	updated_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND revoked_at IS NULL
+	AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOtherRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
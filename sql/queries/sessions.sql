@@ -0,0 +1,41 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, created_at, last_seen_at, user_id, user_agent, ip)
+VALUES (
+	gen_random_uuid(),
+	CURRENT_TIMESTAMP,
+	CURRENT_TIMESTAMP,
+	$1,
+	$2,
+	$3
+)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions WHERE id = $1;
+
+-- name: TouchSession :exec
+UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, ip = $2
+WHERE id = $1;
+
+-- name: ListActiveSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > $2
+ORDER BY last_seen_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :execrows
+UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: SetSessionCookie :exec
+UPDATE sessions SET cookie_hash = $2 WHERE id = $1;
+
+-- name: GetSessionByCookie :one
+SELECT * FROM sessions WHERE cookie_hash = $1;
@@ -0,0 +1,39 @@
+-- name: StartTOTPEnrollment :one
+INSERT INTO totp_credentials (user_id, created_at, updated_at, secret)
+VALUES (
+	$1,
+	CURRENT_TIMESTAMP,
+	CURRENT_TIMESTAMP,
+	$2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, updated_at = CURRENT_TIMESTAMP, last_step = 0
+WHERE totp_credentials.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetTOTPCredential :one
+SELECT * FROM totp_credentials WHERE user_id = $1;
+
+-- name: EnableTOTPCredential :execrows
+UPDATE totp_credentials
+SET enabled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP,
+	last_step = $2
+WHERE user_id = $1 AND enabled_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE totp_credentials SET last_step = $2
+WHERE user_id = $1 AND last_step < $2;
+
+-- name: DeleteTOTPCredential :exec
+DELETE FROM totp_credentials WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, created_at, user_id)
+VALUES ($1, CURRENT_TIMESTAMP, $2);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
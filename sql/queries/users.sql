@@ -13,4 +13,30 @@ RETURNING *;
 SELECT * FROM users WHERE email = $1;
 
 -- name: Reset :exec
-TRUNCATE users CASCADE;
+TRUNCATE users, login_throttles CASCADE;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: UpdateUser :one
+-- A new email address hasn't been verified, whatever the old one was.
+UPDATE users
+SET email = $2, hashed_password = $3, updated_at = CURRENT_TIMESTAMP,
+	verified_at = CASE WHEN email = $2 THEN verified_at ELSE NULL END
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPasswordHash :exec
+UPDATE users SET hashed_password = $2 WHERE id = $1;
+
+-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: MarkUserVerified :execrows
+UPDATE users SET verified_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND email = $2 AND verified_at IS NULL;
+
+-- name: CountUsersCreatedSince :one
+SELECT COUNT(*) FROM users WHERE created_at > $1;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	family_id UUID NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP TABLE refresh_tokens;
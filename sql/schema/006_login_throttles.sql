@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+	kind TEXT NOT NULL CHECK (kind IN ('account', 'ip')),
+	subject TEXT NOT NULL,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked_until TIMESTAMPTZ,
+	PRIMARY KEY (kind, subject)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE totp_credentials (
+	user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	secret TEXT NOT NULL,
+	enabled_at TIMESTAMPTZ,
+	last_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes (
+	code_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	used_at TIMESTAMPTZ
+);
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+DROP TABLE totp_credentials;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN verified_at TIMESTAMPTZ;
+-- Accounts from before verification existed are grandfathered in.
+UPDATE users SET verified_at = created_at;
+
+CREATE TABLE email_verification_tokens (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+CREATE INDEX email_verification_tokens_user_id_idx
+	ON email_verification_tokens (user_id, created_at);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users
+DROP COLUMN verified_at;
@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	redirect_uris TEXT[] NOT NULL,
+	-- NULL for public clients (mobile and browser apps), which can't keep
+	-- a secret and have to rely on PKCE alone.
+	secret_hash TEXT
+);
+
+CREATE TABLE oauth_authorization_codes (
+	code_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE TABLE oauth_grants (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	scope TEXT NOT NULL,
+	PRIMARY KEY (user_id, client_id)
+);
+
+-- +goose Down
+DROP TABLE oauth_grants;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
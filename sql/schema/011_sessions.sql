@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE sessions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_agent TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- Each live refresh token family was a login, so becomes a session; the
+-- family ID is the session ID from now on.
+INSERT INTO sessions (id, created_at, last_seen_at, user_id, user_agent, ip)
+SELECT family_id, MIN(created_at), MAX(updated_at), user_id, '', ''
+FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+GROUP BY family_id, user_id;
+
+-- +goose Down
+DROP TABLE sessions;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE api_keys (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL UNIQUE,
+	key_hash TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ
+);
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
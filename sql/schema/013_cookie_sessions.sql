@@ -0,0 +1,6 @@
+-- +goose Up
+-- Set for sessions the web app holds in a cookie, rather than in tokens.
+ALTER TABLE sessions ADD COLUMN cookie_hash TEXT UNIQUE;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN cookie_hash;
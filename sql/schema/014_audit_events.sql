@@ -0,0 +1,29 @@
+-- +goose Up
+-- No foreign keys: the record of what someone did has to outlive them.
+CREATE TABLE audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	event TEXT NOT NULL,
+	actor_id UUID,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	details JSONB NOT NULL DEFAULT '{}'
+);
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX audit_events_event_idx ON audit_events (event, id);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- device_hash is the hash of a secret given to the device that asked for the
+-- link; only that device can use it.
+CREATE TABLE magic_link_tokens (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device_hash TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+CREATE INDEX magic_link_tokens_user_id_idx
+	ON magic_link_tokens (user_id, created_at);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Proof-of-work challenges that have been spent on a signup, by token ID, so
+-- each can only be used once. They're only kept until they'd have expired
+-- anyway.
+CREATE TABLE used_pow_challenges (
+	id TEXT PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX used_pow_challenges_expires_at_idx
+	ON used_pow_challenges (expires_at);
+
+-- +goose Down
+DROP TABLE used_pow_challenges;
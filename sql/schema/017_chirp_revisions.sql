@@ -0,0 +1,14 @@
+-- +goose Up
+-- Every body a chirp has had before its current one. created_at is when that
+-- body was written, and replaced_at when it was edited away.
+CREATE TABLE chirp_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL,
+	replaced_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	body TEXT NOT NULL
+);
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions (chirp_id, id);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
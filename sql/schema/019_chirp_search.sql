@@ -0,0 +1,10 @@
+-- +goose Up
+-- For full-text search over chirps. Postgres keeps the column up to date
+-- itself, whenever a chirp's posted or edited.
+ALTER TABLE chirps ADD COLUMN search tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+CREATE INDEX chirps_search_idx ON chirps USING GIN (search);
+
+-- +goose Down
+DROP INDEX chirps_search_idx;
+ALTER TABLE chirps DROP COLUMN search;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Set when a refresh token is used up by being exchanged for a new one, as
+-- opposed to being revoked by a logout. Only a rotated token being presented
+-- again means it's been stolen.
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN rotated_at;
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per account (by email, whether or not it exists)
+// and per client IP. Past a number of free failures, each further one locks
+// the account or IP out for twice as long as the last, up to maxLockout.
+const (
+	throttleAccount     = "account"
+	throttleIP          = "ip"
+	accountFreeFailures = 5
+	ipFreeFailures      = 20
+	baseLockout         = time.Second
+	maxLockout          = 15 * time.Minute
+	failureForgetWindow = time.Hour
+	maxLockoutDoublings = 20
+)
+
+// trustedProxiesFromEnv reads CHIRPY_TRUST_PROXY: how many proxies are in
+// front of the server, or "true" for just one.
+func trustedProxiesFromEnv() (int, error) {
+	raw := os.Getenv("CHIRPY_TRUST_PROXY")
+	switch raw {
+	case "", "false":
+		return 0, nil
+	case "true":
+		return 1, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CHIRPY_TRUST_PROXY: %w", err)
+	}
+	if n < 0 {
+		return 0, errors.New("CHIRPY_TRUST_PROXY can't be negative")
+	}
+	return n, nil
+}
+
+// clientIP is the IP the request came from; or, behind trusted proxies, the
+// one the outermost of them says it came from. Each proxy appends the
+// address it got the request from to X-Forwarded-For, so only the last
+// trustedProxies entries are theirs; anything before those came from the
+// client, and could say anything.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustedProxies > 0 {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(strings.Join(fwd, ","), ",")
+			i := max(len(hops)-cfg.trustedProxies, 0)
+			return strings.TrimSpace(hops[i])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func throttleAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// lockoutFor is how long to lock out after the given number of consecutive
+// failures.
+func lockoutFor(failures, freeFailures int32) time.Duration {
+	if failures < freeFailures {
+		return 0
+	}
+	doublings := min(failures-freeFailures, maxLockoutDoublings)
+	return min(baseLockout<<doublings, maxLockout)
+}
+
+// loginLockedFor returns how much longer logins for email, from ip, are
+// locked out; zero if they aren't.
+func (cfg *apiConfig) loginLockedFor(ctx context.Context, email,
+	ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []database.GetLoginThrottleParams{
+		{Kind: throttleAccount, Subject: throttleAccountKey(email)},
+		{Kind: throttleIP, Subject: ip},
+	} {
+		throttle, err := cfg.db.GetLoginThrottle(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if throttle.LockedUntil.Valid {
+			wait = max(wait, time.Until(throttle.LockedUntil.Time))
+		}
+	}
+	return wait, nil
+}
+
+// recordLoginFailure counts a failed login against both email and ip, and
+// locks either out if they've failed too often.
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, email,
+	ip string) {
+	forgetBefore := time.Now().Add(-failureForgetWindow)
+	for _, key := range []struct {
+		kind, subject string
+		free          int32
+	}{
+		{throttleAccount, throttleAccountKey(email), accountFreeFailures},
+		{throttleIP, ip, ipFreeFailures},
+	} {
+		throttle, err := cfg.db.RecordLoginFailure(ctx,
+			database.RecordLoginFailureParams{
+				Kind:         key.kind,
+				Subject:      key.subject,
+				ForgetBefore: forgetBefore,
+			})
+		if err != nil {
+			log.Printf("Error recording login failure: %s", err.Error())
+			continue
+		}
+		lockout := lockoutFor(throttle.Failures, key.free)
+		if lockout == 0 {
+			continue
+		}
+		log.Printf("Locking out %s %s for %s after %d failed logins",
+			key.kind, key.subject, lockout, throttle.Failures)
+		err = cfg.db.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+			Kind:    key.kind,
+			Subject: key.subject,
+			LockedUntil: sql.NullTime{
+				Time:  time.Now().Add(lockout),
+				Valid: true,
+			},
+		})
+		if err != nil {
+			log.Printf("Error locking out %s: %s", key.kind, err.Error())
+		}
+	}
+}
+
+// clearLoginFailures forgets an account's failures after a good login. The
+// IP's count is left alone, so one valid account can't be used to launder
+// guesses at others.
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, email string) {
+	_, err := cfg.db.ClearLoginThrottle(ctx, database.ClearLoginThrottleParams{
+		Kind:    throttleAccount,
+		Subject: throttleAccountKey(email),
+	})
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err.Error())
+	}
+}
+
+// respondLockedOut sends a 429 for a login attempt during a lockout.
+func respondLockedOut(w http.ResponseWriter, wait time.Duration) {
+	secs := int(wait.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w,
+		fmt.Sprintf("Too many failed logins; try again in %d seconds.", secs),
+		http.StatusTooManyRequests)
+}
+
+func (cfg *apiConfig) handlerListLockouts(w http.ResponseWriter, r *http.Request) {
+	type Lockout struct {
+		Kind          string    `json:"kind"`
+		Subject       string    `json:"subject"`
+		Failures      int32     `json:"failures"`
+		LastFailureAt time.Time `json:"last_failure_at"`
+		LockedUntil   time.Time `json:"locked_until"`
+	}
+
+	dbLockouts, err := cfg.db.ListLoginLockouts(r.Context())
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching lockouts: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	lockouts := []Lockout{}
+	for _, dbLockout := range dbLockouts {
+		lockouts = append(lockouts,
+			Lockout{
+				Kind:          dbLockout.Kind,
+				Subject:       dbLockout.Subject,
+				Failures:      dbLockout.Failures,
+				LastFailureAt: dbLockout.LastFailureAt,
+				LockedUntil:   dbLockout.LockedUntil.Time,
+			})
+	}
+
+	err = respondWithJSON(w, 200, lockouts)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerClearLockout(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	subject := r.PathValue("subject")
+	if kind == throttleAccount {
+		subject = throttleAccountKey(subject)
+	}
+	cleared, err := cfg.db.ClearLoginThrottle(r.Context(),
+		database.ClearLoginThrottleParams{Kind: kind, Subject: subject})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error clearing lockout: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if cleared == 0 {
+		http.Error(w, "No such lockout.", http.StatusNotFound)
+		return
+	}
+	log.Printf("Lockout of %s %s lifted", kind, subject)
+	cfg.audit(r, auditAdminClearLockout, authFromContext(r.Context()).UserID,
+		map[string]any{
+			"kind":    kind,
+			"subject": subject,
+		})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const refreshTokenExpiry = 60 * 24 * time.Hour
+
+// issueRefreshToken creates a new refresh token in the given family, stores
+// its hash, and returns the token itself. A fresh login starts a new family,
+// whose ID is the login's session ID; rotation keeps the family, so that
+// reuse can revoke the whole chain.
+func (cfg *apiConfig) issueRefreshToken(ctx context.Context, userID,
+	familyID uuid.UUID) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenExpiry),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing refresh token: %w", err)
+	}
+	return token, nil
+}
+
+func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Println("Error getting bearer token: " + err.Error())
+		http.Error(w, "Authentication error: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	tokenHash := auth.HashToken(token)
+
+	// Revoke the presented token atomically; only one request can ever
+	// rotate a given token, and only while it's still good.
+	oldToken, err := cfg.db.RotateRefreshToken(r.Context(), tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either it never existed, or it's expired, or it's already been
+		// rotated or revoked. A rotated one has been replaced, and only its
+		// thief or its owner has the replacement, so one of them is
+		// replaying it: burn the family. A revoked one is just a client
+		// retrying after logging out.
+		stored, err := cfg.db.GetRefreshToken(r.Context(), tokenHash)
+		if err == nil && !stored.RevokedAt.Valid {
+			http.Error(w, "Refresh token expired.", http.StatusUnauthorized)
+			return
+		}
+		if err == nil && stored.RotatedAt.Valid {
+			log.Printf("Refresh token reuse detected for user %s; revoking session %s",
+				stored.UserID, stored.FamilyID)
+			_, err = cfg.revokeSession(r.Context(), stored.FamilyID,
+				stored.UserID)
+			if err != nil {
+				log.Printf("Error revoking session: %s", err.Error())
+			}
+			cfg.audit(r, auditTokenReuse, stored.UserID, map[string]any{
+				"session_id": stored.FamilyID,
+			})
+		}
+		http.Error(w, "Invalid refresh token.", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error rotating refresh token: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	err = cfg.checkSession(r, oldToken.FamilyID, oldToken.UserID)
+	if err != nil {
+		log.Println("Refresh for dead session: " + err.Error())
+		http.Error(w, "Session has ended; log in again.",
+			http.StatusUnauthorized)
+		return
+	}
+
+	// Look the user up again, rather than trusting the old token, so role
+	// changes take effect on the next refresh.
+	user, err := cfg.db.GetUserByID(r.Context(), oldToken.UserID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	jwt, err := cfg.keyring.Sign(
+		auth.NewClaims(user.ID, user.Role, auth.WithSession(oldToken.FamilyID)),
+		time.Second*defaultExpiryInSeconds)
+	if err != nil {
+		log.Println("Couldn't generate JWT: " + err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := cfg.issueRefreshToken(r.Context(), oldToken.UserID,
+		oldToken.FamilyID)
+	if err != nil {
+		log.Println("Couldn't issue refresh token: " + err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+
+	cfg.audit(r, auditTokenRefresh, user.ID, map[string]any{
+		"session_id": oldToken.FamilyID,
+	})
+	err = respondWithJSON(w, http.StatusOK, Response{
+		Token:        jwt,
+		RefreshToken: refreshToken,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Println("Error getting bearer token: " + err.Error())
+		http.Error(w, "Authentication error: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	// Logging out ends the whole session, so its access tokens stop working
+	// too.
+	stored, err := cfg.db.GetRefreshToken(r.Context(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching refresh token: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	_, err = cfg.revokeSession(r.Context(), stored.FamilyID, stored.UserID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error revoking refresh token: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	cfg.audit(r, auditLogout, stored.UserID, map[string]any{
+		"session_id": stored.FamilyID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := respondWithJSON(w, http.StatusOK, cfg.keyring.JWKS())
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
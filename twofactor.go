@@ -0,0 +1,394 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const loginChallengeExpiry = 5 * time.Minute
+const recoveryCodeCount = 10
+
+var errSecondFactor = errors.New("invalid or already used code")
+
+// hasTwoFactor reports whether a user has finished setting up TOTP.
+func (cfg *apiConfig) hasTwoFactor(ctx context.Context,
+	userID uuid.UUID) (bool, error) {
+	cred, err := cfg.db.GetTOTPCredential(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return cred.EnabledAt.Valid, nil
+}
+
+// checkSecondFactor checks either a TOTP code or a recovery code, and uses it
+// up so it can't be used again. It gives errSecondFactor if neither is good.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context,
+	cred database.TotpCredential, code, recoveryCode string) error {
+	switch {
+	case code != "":
+		step, err := auth.ValidateTOTP(cred.Secret, code, time.Now(),
+			cred.LastStep)
+		if errors.Is(err, auth.ErrTOTPMismatch) {
+			return errSecondFactor
+		}
+		if err != nil {
+			return err
+		}
+		// Losing this race means someone else just used the same code.
+		used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			UserID:   cred.UserID,
+			LastStep: step,
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errSecondFactor
+		}
+		return nil
+	case recoveryCode != "":
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+			UserID:   cred.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errSecondFactor
+		}
+		log.Printf("Recovery code used by user %s", cred.UserID)
+		return nil
+	}
+	return errSecondFactor
+}
+
+func (cfg *apiConfig) handlerTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "change 2FA") {
+		return
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	// Starting over is fine until the enrollment's been confirmed; after
+	// that, 2FA has to be turned off first.
+	_, err = cfg.db.StartTOTPEnrollment(r.Context(),
+		database.StartTOTPEnrollmentParams{UserID: userID, Secret: secret})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "2FA is already enabled.", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error starting 2FA enrollment: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, Response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, user.Email),
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	type TCReq struct {
+		Code string `json:"code"`
+	}
+	type Response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "change 2FA") {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	request := TCReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	cred, err := cfg.db.GetTOTPCredential(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No 2FA enrollment in progress.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching 2FA enrollment: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if cred.EnabledAt.Valid {
+		http.Error(w, "2FA is already enabled.", http.StatusConflict)
+		return
+	}
+	step, err := auth.ValidateTOTP(cred.Secret, request.Code, time.Now(),
+		cred.LastStep)
+	if err != nil {
+		http.Error(w, "Invalid code.", 400)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		enabled, err := q.EnableTOTPCredential(r.Context(),
+			database.EnableTOTPCredentialParams{UserID: userID, LastStep: step})
+		if err != nil {
+			return err
+		}
+		if enabled == 0 {
+			return errors.New("2FA enrollment changed while confirming")
+		}
+		err = q.DeleteRecoveryCodes(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		for _, code := range codes {
+			err = q.CreateRecoveryCode(r.Context(),
+				database.CreateRecoveryCodeParams{
+					CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+					UserID:   userID,
+				})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error enabling 2FA: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("2FA enabled for user %s", userID)
+	cfg.audit(r, auditTOTPEnable, userID, nil)
+
+	// This is the only time the recovery codes are ever shown.
+	err = respondWithJSON(w, http.StatusOK, Response{RecoveryCodes: codes})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	type TDReq struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "change 2FA") {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	request := TDReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	cred, err := cfg.db.GetTOTPCredential(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "2FA is not enabled.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching 2FA settings: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	// A half-finished enrollment can just be dropped; a working one needs
+	// proof of the second factor, or a stolen access token could turn it off.
+	// Guesses at it count against the same lockout as guesses at login, or
+	// that token could be used to guess codes here instead.
+	if cred.EnabledAt.Valid {
+		storedUser, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err != nil {
+			errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 500)
+			return
+		}
+		clientIP := cfg.clientIP(r)
+		wait, err := cfg.loginLockedFor(r.Context(), storedUser.Email,
+			clientIP)
+		if err != nil {
+			errorStr := fmt.Sprintf("Error checking lockout: %s", err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 500)
+			return
+		}
+		if wait > 0 {
+			respondLockedOut(w, wait)
+			return
+		}
+		err = cfg.checkSecondFactor(r.Context(), cred, request.Code,
+			request.RecoveryCode)
+		if errors.Is(err, errSecondFactor) {
+			log.Println("Wrong second factor in 2FA disable.")
+			cfg.recordLoginFailure(r.Context(), storedUser.Email, clientIP)
+			http.Error(w, "Invalid code.", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			errorStr := fmt.Sprintf("Error checking code: %s", err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 500)
+			return
+		}
+		cfg.clearLoginFailures(r.Context(), storedUser.Email)
+	}
+
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		err := q.DeleteTOTPCredential(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		return q.DeleteRecoveryCodes(r.Context(), userID)
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error disabling 2FA: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("2FA disabled for user %s", userID)
+	cfg.audit(r, auditTOTPDisable, userID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerLogin2FA(w http.ResponseWriter, r *http.Request) {
+	type L2Req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		UseCookie      bool   `json:"use_cookie"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := L2Req{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	claims, err := cfg.keyring.ParseFor(request.ChallengeToken,
+		auth.AudienceLoginChallenge)
+	if err != nil {
+		log.Println("Error validating challenge token: " + err.Error())
+		http.Error(w, "Invalid or expired challenge; log in again.",
+			http.StatusUnauthorized)
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge; log in again.",
+			http.StatusUnauthorized)
+		return
+	}
+	storedUser, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching user from DB: %s", err.Error())
+		http.Error(w, "Invalid or expired challenge; log in again.",
+			http.StatusUnauthorized)
+		return
+	}
+
+	// Codes are far easier to guess than passwords, so they're throttled
+	// just the same.
+	clientIP := cfg.clientIP(r)
+	wait, err := cfg.loginLockedFor(r.Context(), storedUser.Email, clientIP)
+	if err != nil {
+		log.Printf("Error checking login lockout: %s", err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+
+	cred, err := cfg.db.GetTOTPCredential(r.Context(), userID)
+	if err != nil || !cred.EnabledAt.Valid {
+		http.Error(w, "Invalid or expired challenge; log in again.",
+			http.StatusUnauthorized)
+		return
+	}
+	err = cfg.checkSecondFactor(r.Context(), cred, request.Code,
+		request.RecoveryCode)
+	if errors.Is(err, errSecondFactor) {
+		log.Println("Wrong second factor in login attempt.")
+		cfg.recordLoginFailure(r.Context(), storedUser.Email, clientIP)
+		cfg.audit(r, auditLoginFailure, storedUser.ID, map[string]any{
+			"email":  storedUser.Email,
+			"reason": "wrong_code",
+		})
+		http.Error(w, "Invalid code.", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking second factor: %s", err.Error())
+		http.Error(w, "Auth failed but because of us, not you.",
+			http.StatusInternalServerError)
+		return
+	}
+	cfg.clearLoginFailures(r.Context(), storedUser.Email)
+
+	cfg.respondWithLogin(w, r, storedUser, time.Second*defaultExpiryInSeconds,
+		request.UseCookie)
+}
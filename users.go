@@ -0,0 +1,322 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// isUniqueViolation reports whether err is Postgres refusing a write because
+// of a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// setPasswordPolicyFromEnv sets up the password policy from
+// CHIRPY_PASSWORD_MIN_LENGTH, CHIRPY_PASSWORD_MAX_LENGTH and
+// CHIRPY_BREACHED_PASSWORDS, leaving the defaults for whatever isn't set.
+func setPasswordPolicyFromEnv() error {
+	policy := auth.DefaultPasswordPolicy
+	for _, setting := range []struct {
+		env   string
+		value *int
+	}{
+		{"CHIRPY_PASSWORD_MIN_LENGTH", &policy.MinLength},
+		{"CHIRPY_PASSWORD_MAX_LENGTH", &policy.MaxLength},
+	} {
+		raw := os.Getenv(setting.env)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", setting.env, err)
+		}
+		*setting.value = n
+	}
+	if path := os.Getenv("CHIRPY_BREACHED_PASSWORDS"); path != "" {
+		breached, err := auth.OpenBreachedList(path)
+		if err != nil {
+			return err
+		}
+		policy.Breached = breached
+	}
+	return auth.SetPasswordPolicy(policy)
+}
+
+// respondPolicyError answers a request with a 400 listing what's wrong with
+// the password, if err is the password policy's; it reports whether it was.
+func respondPolicyError(w http.ResponseWriter, err error) bool {
+	type Response struct {
+		Error      string                 `json:"error"`
+		Message    string                 `json:"message"`
+		Violations []auth.PolicyViolation `json:"violations"`
+	}
+	var policyErr *auth.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	err = respondWithJSON(w, http.StatusBadRequest, Response{
+		Error:      "password_policy",
+		Message:    policyErr.Error(),
+		Violations: policyErr.Violations,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+	return true
+}
+
+// checkNewPassword checks a new password for the user with email against the
+// password policy. If it fails, it answers the request itself and returns
+// false.
+func checkNewPassword(w http.ResponseWriter, password, email string) bool {
+	err := auth.CheckPasswordPolicy(password, email)
+	if err == nil {
+		return true
+	}
+	if !respondPolicyError(w, err) {
+		errorStr := fmt.Sprintf("Error checking password: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+	}
+	return false
+}
+
+// rehashPassword replaces a user's password hash with a fresh one. Failing
+// isn't fatal; the old hash still works, and we'll try again next login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID,
+	password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err.Error())
+		return
+	}
+	err = cfg.db.UpdateUserPasswordHash(ctx,
+		database.UpdateUserPasswordHashParams{
+			ID:             userID,
+			HashedPassword: hashedPassword,
+		})
+	if err != nil {
+		log.Printf("Error storing rehashed password: %s", err.Error())
+	}
+}
+
+func (cfg *apiConfig) handlerUserUpdate(w http.ResponseWriter, r *http.Request) {
+	type UUReq struct {
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+	}
+	type Response struct {
+		ID         string    `json:"id"`
+		Created_at time.Time `json:"created_at"`
+		Updated_at time.Time `json:"updated_at"`
+		Email      string    `json:"email"`
+	}
+
+	ra := authFromContext(r.Context())
+	userID := ra.UserID
+	if refuseImpersonation(w, r, "change email or password") {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := UUReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if request.Email == "" && request.Password == "" {
+		http.Error(w, "Nothing to update: give an email, a password, or both.",
+			400)
+		return
+	}
+
+	storedUser, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+
+	// A stolen access token alone shouldn't be enough to take over the
+	// account, so changing the password, or the email a reset would go to,
+	// needs the current password.
+	err = auth.CheckPasswordHash(storedUser.HashedPassword,
+		request.CurrentPassword)
+	if err != nil {
+		log.Println("Current password mismatch in user update.")
+		http.Error(w, "Current password is incorrect.", http.StatusUnauthorized)
+		return
+	}
+
+	// Keep whatever isn't being changed.
+	params := database.UpdateUserParams{
+		ID:             storedUser.ID,
+		Email:          storedUser.Email,
+		HashedPassword: storedUser.HashedPassword,
+	}
+	if request.Email != "" {
+		if !validEmail(request.Email) {
+			http.Error(w, "Not a valid email address.", 400)
+			return
+		}
+		params.Email = request.Email
+	}
+	if request.Password != "" {
+		if !checkNewPassword(w, request.Password, params.Email) {
+			return
+		}
+		params.HashedPassword, err = auth.HashPassword(request.Password)
+		if err != nil {
+			errorStr := fmt.Sprintf("Error updating user: %s", err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 400)
+			return
+		}
+	}
+
+	// A new password logs out everywhere but here, as a reset does
+	// everywhere, so whoever knew the old one is out too.
+	var updatedUser database.User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		updatedUser, err = q.UpdateUser(r.Context(), params)
+		if err != nil || request.Password == "" {
+			return err
+		}
+		_, err = q.RevokeOtherSessions(r.Context(),
+			database.RevokeOtherSessionsParams{
+				UserID: userID,
+				ID:     ra.SessionID,
+			})
+		if err != nil {
+			return err
+		}
+		return q.RevokeOtherRefreshTokens(r.Context(),
+			database.RevokeOtherRefreshTokensParams{
+				UserID:   userID,
+				FamilyID: ra.SessionID,
+			})
+	})
+	if isUniqueViolation(err) {
+		http.Error(w, "Email is already in use.", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error updating user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if request.Password != "" {
+		cfg.audit(r, auditPasswordChange, userID, nil)
+	}
+	if updatedUser.Email != storedUser.Email {
+		cfg.audit(r, auditEmailChange, userID, map[string]any{
+			"old_email": storedUser.Email,
+			"new_email": updatedUser.Email,
+		})
+		err = cfg.sendVerificationEmail(r.Context(), updatedUser)
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err.Error())
+		}
+	}
+
+	err = respondWithJSON(w, http.StatusOK, Response{
+		ID:         updatedUser.ID.String(),
+		Created_at: updatedUser.CreatedAt,
+		Updated_at: updatedUser.UpdatedAt,
+		Email:      updatedUser.Email,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
+
+func (cfg *apiConfig) handlerSetRole(w http.ResponseWriter, r *http.Request) {
+	type SRReq struct {
+		Role string `json:"role"`
+	}
+	type Response struct {
+		ID         string    `json:"id"`
+		Created_at time.Time `json:"created_at"`
+		Updated_at time.Time `json:"updated_at"`
+		Email      string    `json:"email"`
+		Role       string    `json:"role"`
+	}
+
+	reqID := r.PathValue("id")
+	userID, err := uuid.Parse(reqID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Not a valid user ID (UUID): %s: %s",
+			reqID, err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := SRReq{}
+	err = decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+	if len(auth.ScopesForRole(request.Role)) == 0 {
+		http.Error(w, "Unknown role: "+request.Role, 400)
+		return
+	}
+
+	updatedUser, err := cfg.db.SetUserRole(r.Context(),
+		database.SetUserRoleParams{ID: userID, Role: request.Role})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such user.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error setting role: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	log.Printf("Role of user %s set to %q", updatedUser.ID, updatedUser.Role)
+	cfg.audit(r, auditAdminSetRole, authFromContext(r.Context()).UserID,
+		map[string]any{
+			"user_id": updatedUser.ID,
+			"role":    updatedUser.Role,
+		})
+
+	err = respondWithJSON(w, http.StatusOK, Response{
+		ID:         updatedUser.ID.String(),
+		Created_at: updatedUser.CreatedAt,
+		Updated_at: updatedUser.UpdatedAt,
+		Email:      updatedUser.Email,
+		Role:       updatedUser.Role,
+	})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error responding: %s", err.Error())
+		log.Println(errorStr)
+	}
+}
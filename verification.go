@@ -0,0 +1,191 @@
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const verificationExpiry = 24 * time.Hour
+
+// Resending is limited both in bursts and per day, so the endpoint can't be
+// used to flood someone's inbox.
+const (
+	verificationResendInterval = time.Minute
+	verificationDailyLimit     = 5
+)
+
+// validEmail reports whether email looks like a bare address we could send
+// mail to; "Name <addr>" forms are refused.
+func validEmail(email string) bool {
+	addr, err := netmail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// sendVerificationEmail mails user a token proving they own their current
+// email address.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context,
+	user database.User) error {
+	token, err := auth.MakeToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreateEmailVerificationToken(ctx,
+		database.CreateEmailVerificationTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    user.ID,
+			Email:     user.Email,
+			ExpiresAt: time.Now().Add(verificationExpiry),
+		})
+	if err != nil {
+		return fmt.Errorf("error creating verification token: %w", err)
+	}
+
+	cfg.sendMailAsync(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your Chirpy email address",
+		Body: "To confirm this is your email address, use this token within " +
+			"the next day:\n\n" +
+			"    " + token + "\n\n" +
+			"If you didn't sign up for Chirpy, you can ignore this email.\n",
+	})
+	return nil
+}
+
+// checkVerified answers, and returns false, if users have to verify their
+// email address before chirping, and userID hasn't.
+func (cfg *apiConfig) checkVerified(w http.ResponseWriter, r *http.Request,
+	userID uuid.UUID) bool {
+	if !cfg.requireVerified {
+		return true
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return false
+	}
+	if !user.VerifiedAt.Valid {
+		http.Error(w, "Verify your email address before chirping.",
+			http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type VEReq struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	request := VEReq{}
+	err := decoder.Decode(&request)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error decoding parameters: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 400)
+		return
+	}
+
+	token, err := cfg.db.UseEmailVerificationToken(r.Context(),
+		auth.HashToken(request.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Invalid or expired verification token.", 400)
+		return
+	}
+	if err != nil {
+		errorStr := fmt.Sprintf("Error verifying email: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	// The token only vouches for the address it was sent to; if the user's
+	// changed it since, it proves nothing.
+	verified, err := cfg.db.MarkUserVerified(r.Context(),
+		database.MarkUserVerifiedParams{ID: token.UserID, Email: token.Email})
+	if err != nil {
+		errorStr := fmt.Sprintf("Error verifying email: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if verified == 0 {
+		http.Error(w, "Invalid or expired verification token.", 400)
+		return
+	}
+	log.Printf("Email verified for user %s", token.UserID)
+	cfg.audit(r, auditEmailVerify, token.UserID, map[string]any{
+		"email": token.Email,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := authFromContext(r.Context()).UserID
+	if refuseImpersonation(w, r, "send verification emails") {
+		return
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error fetching user: %s", err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	if user.VerifiedAt.Valid {
+		http.Error(w, "Email is already verified.", http.StatusConflict)
+		return
+	}
+
+	for _, limit := range []struct {
+		window time.Duration
+		max    int64
+	}{
+		{verificationResendInterval, 1},
+		{24 * time.Hour, verificationDailyLimit},
+	} {
+		sent, err := cfg.db.CountEmailVerificationTokensSince(r.Context(),
+			database.CountEmailVerificationTokensSinceParams{
+				UserID:    userID,
+				CreatedAt: time.Now().Add(-limit.window),
+			})
+		if err != nil {
+			errorStr := fmt.Sprintf("Error checking resend limit: %s",
+				err.Error())
+			log.Println(errorStr)
+			http.Error(w, errorStr, 500)
+			return
+		}
+		if sent >= limit.max {
+			secs := int(limit.window.Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			http.Error(w, "Too many verification emails; try again later.",
+				http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		errorStr := fmt.Sprintf("Error sending verification email: %s",
+			err.Error())
+		log.Println(errorStr)
+		http.Error(w, errorStr, 500)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"user@example.com", true},
+		{"first.last+chirpy@example.org", true},
+		{"", false},
+		{"user", false},
+		{"user@", false},
+		{"Some User <user@example.com>", false},
+		{" user@example.com", false},
+		{"user@example.com, other@example.org", false},
+	}
+	for _, tt := range tests {
+		if got := validEmail(tt.email); got != tt.want {
+			t.Errorf("validEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}